@@ -282,11 +282,26 @@ sub load_config
 # SAVE / LOAD PERSISTANT DATA
 ###
 
+sub persist_path
+{
+    # Persistent data is managed by the agent
+    return $ENV{"WIGO_PROBE_PERSIST_FILE"} if $ENV{"WIGO_PROBE_PERSIST_FILE"};
+
+    return $PERSIST_PATH . "/" . $name . ".wigo";
+}
+
 sub save
 {
     return unless $persist;
 
-    my $path = $PERSIST_PATH . "/" . $name . ".wigo";
+    # The agent stores the persistent data returned in the result
+    if ( $ENV{"WIGO_PROBE_PERSIST_FILE"} )
+    {
+        $result->{'persist'} = $persist;
+        return;
+    }
+
+    my $path = persist_path();
 
     if ( open PERSIST, '>', $path )
     {
@@ -312,7 +327,7 @@ sub save
 
 sub restore
 {
-    my $path = $PERSIST_PATH . "/" . $name . ".wigo";
+    my $path = persist_path();
 
     return unless -e $path;
 
@@ -363,6 +378,10 @@ sub getLevel {
     {
         return 'CRIT';
     }
+    elsif ( $code >= 900 and $code < 1000 )
+    {
+        return 'UNKNOWN';
+    }
     else
     {
         return 'ERROR';
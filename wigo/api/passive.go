@@ -0,0 +1,145 @@
+// Package api holds the HTTP handlers of the wigo agent
+package api
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/executor"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxPassiveResultSize is the maximum size of a submitted result
+const MaxPassiveResultSize = 1048576
+
+var passiveNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// SubmitFunc store the result of a passive probe expected
+// to be refreshed within ttl seconds
+type SubmitFunc func(name string, result *executor.ProbeResult, ttl int) error
+
+// RemoveFunc remove a passive probe
+type RemoveFunc func(name string)
+
+// PassiveHandler accept passive probe results submitted by
+// external producers :
+//
+//	POST   /passive/<name>?ttl=<seconds>   submit a ProbeResult JSON
+//	DELETE /passive/<name>                 remove the passive probe
+type PassiveHandler struct {
+	DefaultTtl int
+	Login      string
+	Password   string
+
+	submit SubmitFunc
+	remove RemoveFunc
+}
+
+// NewPassiveHandler create a new PassiveHandler instance
+func NewPassiveHandler(submit SubmitFunc, remove RemoveFunc, defaultTtl int) (h *PassiveHandler) {
+	h = new(PassiveHandler)
+	h.DefaultTtl = defaultTtl
+	h.submit = submit
+	h.remove = remove
+	return
+}
+
+func (h *PassiveHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if h.Login != "" {
+		login, password, ok := req.BasicAuth()
+		if !ok || login != h.Login || password != h.Password {
+			resp.Header().Set("WWW-Authenticate", `Basic realm="wigo"`)
+			http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	name := strings.TrimPrefix(req.URL.Path, "/passive/")
+	if !passiveNameRegexp.MatchString(name) {
+		http.Error(resp, fmt.Sprintf("Invalid passive probe name %s", name), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case "POST", "PUT":
+		h.handleSubmit(resp, req, name)
+	case "DELETE":
+		h.remove(name)
+		resp.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(resp, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *PassiveHandler) handleSubmit(resp http.ResponseWriter, req *http.Request, name string) {
+	ttl := h.DefaultTtl
+	if str := req.URL.Query().Get("ttl"); str != "" {
+		var err error
+		if ttl, err = strconv.Atoi(str); err != nil || ttl <= 0 {
+			http.Error(resp, fmt.Sprintf("Invalid ttl %s", str), http.StatusBadRequest)
+			return
+		}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, MaxPassiveResultSize+1))
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("Unable to read result : %s", err), http.StatusBadRequest)
+		return
+	}
+	if len(body) > MaxPassiveResultSize {
+		http.Error(resp, "Result too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	result, err := executor.NewProbeResultFromJSON(body)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("Unable to deserialize result : %s", err), http.StatusBadRequest)
+		return
+	}
+	result.Clean()
+	result.Persist = nil
+
+	if err = h.submit(name, result, ttl); err != nil {
+		http.Error(resp, err.Error(), http.StatusConflict)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// ServeUnixSocket serve handler on a unix socket readable
+// and writable by the owner and group only. The returned
+// server is closed to stop listening on the socket.
+func ServeUnixSocket(path string, handler http.Handler) (server *http.Server, err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	// Remove the socket left by a previous run
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return
+	}
+
+	server = &http.Server{Handler: handler}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Warnf("Unix socket %s server stopped : %s", path, err)
+		}
+	}()
+	return
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/root-gg/wigo/wigo/executor"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const tmpPassiveSocket = "/tmp/wigo_api_test/passive.sock"
+
+type submission struct {
+	name   string
+	result *executor.ProbeResult
+	ttl    int
+}
+
+func newTestHandler(submissions *[]submission) *PassiveHandler {
+	submit := func(name string, result *executor.ProbeResult, ttl int) error {
+		if name == "scheduled" {
+			return errors.New("Probe scheduled is not a passive probe")
+		}
+		*submissions = append(*submissions, submission{name, result, ttl})
+		return nil
+	}
+	return NewPassiveHandler(submit, func(name string) {}, 60)
+}
+
+func TestPassiveHandler(t *testing.T) {
+	var submissions []submission
+	server := httptest.NewServer(newTestHandler(&submissions))
+	defer server.Close()
+
+	result := `{"status":300,"message":"backup failed","exitCode":3}`
+	tests := map[string]int{
+		"/passive/backup":          http.StatusNoContent,
+		"/passive/backup?ttl=3600": http.StatusNoContent,
+		"/passive/backup?ttl=foo":  http.StatusBadRequest,
+		"/passive/../backup":       http.StatusBadRequest,
+		"/passive/scheduled":       http.StatusConflict,
+	}
+	for url, status := range tests {
+		resp, err := http.Post(server.URL+url, "application/json", bytes.NewBufferString(result))
+		if err != nil {
+			t.Fatalf("Unable to submit result : %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("Invalid response status %d for %s, expected %d", resp.StatusCode, url, status)
+		}
+	}
+
+	if len(submissions) != 2 {
+		t.Fatalf("Invalid submissions count %d, expected %d", len(submissions), 2)
+	}
+	for _, s := range submissions {
+		if s.name != "backup" || s.result.Status != 300 || s.result.ExitCode != 0 {
+			t.Fatalf("Invalid submission %v", s)
+		}
+		if s.ttl != 60 && s.ttl != 3600 {
+			t.Fatalf("Invalid submission ttl %d", s.ttl)
+		}
+	}
+
+	resp, err := http.Post(server.URL+"/passive/backup", "application/json", bytes.NewBufferString("{"))
+	if err != nil {
+		t.Fatalf("Unable to submit result : %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Invalid response status %d, expected %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestPassiveHandlerAuth(t *testing.T) {
+	var submissions []submission
+	handler := newTestHandler(&submissions)
+	handler.Login = "wigo"
+	handler.Password = "secret"
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/passive/backup", "application/json", bytes.NewBufferString(`{"status":100}`))
+	if err != nil {
+		t.Fatalf("Unable to submit result : %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Invalid response status %d, expected %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	req, _ := http.NewRequest("POST", server.URL+"/passive/backup", bytes.NewBufferString(`{"status":100}`))
+	req.SetBasicAuth("wigo", "secret")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("Unable to submit result : %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Invalid response status %d, expected %d", resp.StatusCode, http.StatusNoContent)
+	}
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	var submissions []submission
+	server, err := ServeUnixSocket(tmpPassiveSocket, newTestHandler(&submissions))
+	if err != nil {
+		t.Fatalf("Unable to serve unix socket : %s", err)
+	}
+	defer server.Close()
+
+	client := new(http.Client)
+	client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return net.Dial("unix", tmpPassiveSocket)
+		},
+	}
+	resp, err := client.Post("http://wigo/passive/backup", "application/json", bytes.NewBufferString(`{"status":100}`))
+	if err != nil {
+		t.Fatalf("Unable to submit result : %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || len(submissions) != 1 {
+		t.Fatalf("Invalid response status %d, expected %d", resp.StatusCode, http.StatusNoContent)
+	}
+}
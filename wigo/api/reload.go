@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ReloadFunc reload the configuration file and return the
+// sections of the configuration that changed
+type ReloadFunc func() (changed []string, err error)
+
+// ReloadHandler reload the configuration of the agent like SIGHUP :
+//
+//	POST   /reload   reload wigo.conf, the changed sections are returned
+//
+// An invalid configuration is not applied, the error is returned
+// and the agent keeps running with its current configuration.
+type ReloadHandler struct {
+	Login    string
+	Password string
+
+	reload ReloadFunc
+}
+
+// NewReloadHandler create a new ReloadHandler instance
+func NewReloadHandler(reload ReloadFunc) (h *ReloadHandler) {
+	h = new(ReloadHandler)
+	h.reload = reload
+	return
+}
+
+func (h *ReloadHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if h.Login != "" {
+		login, password, ok := req.BasicAuth()
+		if !ok || login != h.Login || password != h.Password {
+			resp.Header().Set("WWW-Authenticate", `Basic realm="wigo"`)
+			http.Error(resp, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if req.Method != "POST" {
+		http.Error(resp, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	changed, err := h.reload()
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(map[string][]string{"changed": changed})
+}
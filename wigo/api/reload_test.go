@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReloadHandler(t *testing.T) {
+	var err error
+	reload := func() ([]string, error) {
+		return []string{"Http"}, err
+	}
+	server := httptest.NewServer(NewReloadHandler(reload))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/reload")
+	if err != nil {
+		t.Fatalf("Unable to reload : %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Invalid response status %d, expected %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	resp, err = http.Post(server.URL+"/reload", "", nil)
+	if err != nil {
+		t.Fatalf("Unable to reload : %s", err)
+	}
+	var body map[string][]string
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Unable to decode response : %s", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(body["changed"]) != 1 || body["changed"][0] != "Http" {
+		t.Fatalf("Invalid response %d %v", resp.StatusCode, body)
+	}
+
+	// An invalid configuration is reported
+	err = errors.New("Invalid Watcher.Mode foo")
+	resp, postErr := http.Post(server.URL+"/reload", "", nil)
+	if postErr != nil {
+		t.Fatalf("Unable to reload : %s", postErr)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("Invalid response status %d, expected %d", resp.StatusCode, http.StatusUnprocessableEntity)
+	}
+}
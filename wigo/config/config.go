@@ -1,10 +1,9 @@
 package config
 
 import (
-	"github.com/BurntSushi/toml"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
-	"github.com/root-gg/utils"
-	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -13,28 +12,50 @@ var config *Config
 
 // LoadConfig application configuration
 func LoadDefaultConfig() (err error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
 	config = NewConfig()
 	config.Initialize()
+	sources = nil
 	return
 }
 
-// LoadConfig application configuration
-func LoadConfig(configFile string) (err error) {
-	config = NewConfig()
-	if err = config.Load(configFile); err != nil {
-		return
+// LoadConfig application configuration. Unknown keys and deprecated
+// keys are reported, the configuration is not loaded if it has errors.
+func LoadConfig(path string) (err error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	c, s, problems := load(path)
+	problems.Log(path)
+	if errors := problems.Errors(); len(errors) > 0 {
+		return errors
 	}
-	config.Initialize()
+
+	configFile = path
+	config = c
+	sources = s
 	return
 }
 
 // GetConfig return the application configuration
 func GetConfig() *Config {
+	configLock.Lock()
+	defer configLock.Unlock()
+
 	return config
 }
 
+// Dump print every value of the application configuration
+// with its source ( default, file, env or flag )
 func Dump() {
-	utils.Dump(config)
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	for _, line := range dump(config, sources) {
+		fmt.Println(line)
+	}
 }
 
 type Config struct {
@@ -59,6 +80,15 @@ type Config struct {
 
 	// OpenTSDB params
 	OpenTSDB *OpenTSDBConfig
+
+	// Probes execution params
+	Probes *ProbesConfig
+
+	// Probes directory layout params
+	Watcher *WatcherConfig
+
+	// Passive probes params
+	Passive *PassiveConfig
 }
 
 type GeneralConfig struct {
@@ -68,6 +98,7 @@ type GeneralConfig struct {
 	ProbesDirectory       string
 	ProbesConfigDirectory string
 	ProbesLibDirectory    string
+	ProbesStateDirectory  string
 	UuidFile              string
 	LogFile               string
 	Debug                 bool
@@ -160,6 +191,221 @@ type OpenTSDBConfig struct {
 	Tags          map[string]string
 }
 
+type PassiveConfig struct {
+	Enabled    bool
+	Socket     string
+	DefaultTtl int
+}
+
+// Probe directory watcher modes
+const (
+	WatcherAuto    = "auto"
+	WatcherInotify = "inotify"
+	WatcherPolling = "polling"
+)
+
+// WatcherConfig holds the layout of the probes directory
+// and how changes are detected
+type WatcherConfig struct {
+	// Watch probe directories at any depth ( eg : probes/<team>/<interval> )
+	Recursive bool
+
+	// Intervals of probe directories not named by a number of seconds
+	Intervals map[string]int
+
+	// Milliseconds without event on a file before it is handled
+	Debounce int
+
+	// Change detection ( "auto", "inotify" or "polling" ) and
+	// seconds between two scans of the polled directories
+	Mode         string
+	PollInterval int
+
+	// Globs matched against probe file names. If Include is not empty
+	// probes must match one of its globs, probes matching one of the
+	// Exclude globs are ignored.
+	Include []string
+	Exclude []string
+}
+
+// Suffix of the probes parked without being deleted
+const DisabledSuffix = ".disabled"
+
+// DefaultExclude ignore hidden files, editor temporary files,
+// backups and package manager leftovers
+var DefaultExclude = []string{
+	".*", "*~", "#*#", "*.swp", "*.swo", "*.swx", "*.tmp", "*.bak", "*.orig", "*.rej",
+	"*.dpkg-*", "*.rpmnew", "*.rpmsave", "*.rpmorig", "*.ucf-*", "README*",
+}
+
+// Accept return true if the file name is a probe, not disabled
+// and allowed by the include and exclude globs
+func (this *WatcherConfig) Accept(name string) bool {
+	if strings.HasSuffix(name, DisabledSuffix) {
+		return false
+	}
+	for _, glob := range this.Exclude {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return false
+		}
+	}
+	if len(this.Include) == 0 {
+		return true
+	}
+	for _, glob := range this.Include {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Interval return the delay in seconds between two executions
+// of the probes of a directory, false if the directory name is
+// neither a number nor a declared interval.
+func (this *WatcherConfig) Interval(directory string) (interval int, ok bool) {
+	if interval, ok = this.Intervals[directory]; ok {
+		return interval, interval > 0
+	}
+	interval, err := strconv.Atoi(directory)
+	return interval, err == nil && interval > 0
+}
+
+// ProbeSettings holds the parameters used by the ProbeExecutor
+// to run a probe
+type ProbeSettings struct {
+	// Output format ( "wigo" or "nagios" )
+	Mode string
+
+	// Input given on stdin ( "none" or "json" )
+	Input string
+
+	// Keep the probe running and read a result per line
+	Daemon      bool
+	StaleWindow int
+
+	// Output capture
+	MaxStdoutSize int
+	MaxStderrSize int
+	KeepStderr    bool
+
+	// Privileges and resource limits
+	User         string
+	Group        string
+	Nice         int
+	MaxCpuTime   int
+	MaxMemory    int
+	MaxOpenFiles int
+	MaxProcesses int
+
+	// Arguments and environment
+	Args     []string
+	Env      map[string]string
+	CleanEnv bool
+}
+
+// NewProbeSettings return the default probe settings
+func NewProbeSettings() (this *ProbeSettings) {
+	this = new(ProbeSettings)
+	this.Mode = "wigo"
+	this.Input = "none"
+	this.MaxStdoutSize = 1048576
+	this.MaxStderrSize = 65536
+	this.KeepStderr = false
+	return
+}
+
+// merge override settings with every non zero value of other
+func (this *ProbeSettings) merge(other *ProbeSettings) {
+	if other.Mode != "" {
+		this.Mode = other.Mode
+	}
+	if other.Input != "" {
+		this.Input = other.Input
+	}
+	if other.Daemon {
+		this.Daemon = true
+	}
+	if other.StaleWindow != 0 {
+		this.StaleWindow = other.StaleWindow
+	}
+	if other.MaxStdoutSize != 0 {
+		this.MaxStdoutSize = other.MaxStdoutSize
+	}
+	if other.MaxStderrSize != 0 {
+		this.MaxStderrSize = other.MaxStderrSize
+	}
+	if other.KeepStderr {
+		this.KeepStderr = true
+	}
+	if other.User != "" {
+		this.User = other.User
+	}
+	if other.Group != "" {
+		this.Group = other.Group
+	}
+	if other.Nice != 0 {
+		this.Nice = other.Nice
+	}
+	if other.MaxCpuTime != 0 {
+		this.MaxCpuTime = other.MaxCpuTime
+	}
+	if other.MaxMemory != 0 {
+		this.MaxMemory = other.MaxMemory
+	}
+	if other.MaxOpenFiles != 0 {
+		this.MaxOpenFiles = other.MaxOpenFiles
+	}
+	if other.MaxProcesses != 0 {
+		this.MaxProcesses = other.MaxProcesses
+	}
+	if other.Args != nil {
+		this.Args = other.Args
+	}
+	if other.Env != nil {
+		// Never modify a map shared with the settings we inherit from
+		env := make(map[string]string)
+		for key, value := range this.Env {
+			env[key] = value
+		}
+		for key, value := range other.Env {
+			env[key] = value
+		}
+		this.Env = env
+	}
+	if other.CleanEnv {
+		this.CleanEnv = true
+	}
+}
+
+// ProbesConfig holds the default probe settings and
+// the overrides by probe directory and by probe name
+type ProbesConfig struct {
+	ProbeSettings
+
+	Directory map[string]*ProbeSettings
+	Probe     map[string]*ProbeSettings
+}
+
+// Settings return the settings of the probe located at path.
+// Defaults are overridden by the settings of the probe directory
+// ( eg : "60" ) and then by the settings of the probe name ( eg : "dummy" ).
+func (this *ProbesConfig) Settings(path string) (settings *ProbeSettings) {
+	settings = new(ProbeSettings)
+	*settings = this.ProbeSettings
+
+	if directory, ok := this.Directory[filepath.Base(filepath.Dir(path))]; ok {
+		settings.merge(directory)
+	}
+
+	fileName := filepath.Base(path)
+	name := fileName[0 : len(fileName)-len(filepath.Ext(fileName))]
+	if probe, ok := this.Probe[name]; ok {
+		settings.merge(probe)
+	}
+	return
+}
+
 func NewConfig() (this *Config) {
 	// General params
 	this = new(Config)
@@ -170,12 +416,16 @@ func NewConfig() (this *Config) {
 	this.RemoteWigos = new(RemoteWigoConfig)
 	this.Notifications = new(NotificationConfig)
 	this.OpenTSDB = new(OpenTSDBConfig)
+	this.Probes = new(ProbesConfig)
+	this.Passive = new(PassiveConfig)
+	this.Watcher = new(WatcherConfig)
 
 	this.Global.Hostname = ""
 	this.Global.Group = "none"
 	this.Global.ProbesDirectory = "/usr/local/wigo/probes"
 	this.Global.ProbesConfigDirectory = "/etc/wigo/conf.probes"
 	this.Global.ProbesLibDirectory = "/var/lib/wigo/lib"
+	this.Global.ProbesStateDirectory = "/var/lib/wigo/state"
 	this.Global.LogFile = "/var/log/wigo.log"
 	this.Global.UuidFile = "/var/lib/wigo/uuid"
 	this.Global.Database = "/var/lib/wigo/wigo.db"
@@ -243,13 +493,33 @@ func NewConfig() (this *Config) {
 	this.OpenTSDB.BufferSize = 10000
 	this.OpenTSDB.Tags = make(map[string]string)
 
+	// Probes
+	this.Probes.ProbeSettings = *NewProbeSettings()
+	this.Probes.Directory = make(map[string]*ProbeSettings)
+	this.Probes.Probe = make(map[string]*ProbeSettings)
+
+	// Passive probes
+	this.Passive.Enabled = false
+	this.Passive.Socket = "/var/run/wigo/passive.sock"
+	this.Passive.DefaultTtl = 3600
+
+	// Probes directory layout
+	this.Watcher.Recursive = false
+	this.Watcher.Intervals = make(map[string]int)
+	this.Watcher.Debounce = 500
+	this.Watcher.Mode = WatcherAuto
+	this.Watcher.PollInterval = 10
+	this.Watcher.Include = nil
+	this.Watcher.Exclude = append([]string{}, DefaultExclude...)
+
 	return
 }
 
-// Load config from file
+// Load config from file, and then from the fragments
+// of its include directory in lexical order
 func (c *Config) Load(configFile string) (err error) {
-	if _, err = toml.DecodeFile(configFile, &c); err != nil {
-		log.Errorf("Failed to load configuration from file %s : %s", configFile, err)
+	if _, err = c.decodeFiles(configFile); err != nil {
+		log.Errorf("Failed to load configuration : %s", err)
 	}
 	return
 }
@@ -268,9 +538,7 @@ func (c *Config) Initialize() {
 				port, _ = strconv.Atoi(splits[1])
 			}
 
-			if port == 0 {
-				port = c.Global.ListenPort
-			}
+			port = c.remotePort(port)
 
 			// Create new RemoteWigoConfig
 			AdvancedRemoteWigo := new(AdvancedRemoteWigoConfig)
@@ -286,9 +554,23 @@ func (c *Config) Initialize() {
 		}
 	}
 
+	for i := range c.AdvancedList {
+		c.AdvancedList[i].Port = c.remotePort(c.AdvancedList[i].Port)
+	}
+
 	c.RemoteWigos.AdvancedList = c.AdvancedList
 	c.AdvancedList = nil
+}
 
-	os.Setenv("WIGO_PROBE_CONFIG_ROOT", c.Global.ProbesConfigDirectory)
-	os.Setenv("WIGO_PROBE_LIB_ROOT", c.Global.ProbesLibDirectory)
+// remotePort return the port to connect to on a remote wigo,
+// remote wigos listen on Http.Port unless told otherwise. The
+// deprecated Global.ListenPort is still used if it is set.
+func (c *Config) remotePort(port int) int {
+	switch {
+	case port != 0:
+		return port
+	case c.Global.ListenPort != 0:
+		return c.Global.ListenPort
+	}
+	return c.Http.Port
 }
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -24,3 +27,452 @@ func TestDumpConfig(t *testing.T) {
 	config = NewConfig()
 	Dump()
 }
+
+func TestProbeSettings(t *testing.T) {
+	config := NewConfig()
+	config.Probes.User = "nobody"
+	config.Probes.Directory["60"] = &ProbeSettings{MaxCpuTime: 10, KeepStderr: true}
+	config.Probes.Probe["dummy"] = &ProbeSettings{MaxCpuTime: 20, User: "wigo"}
+
+	settings := config.Probes.Settings("/usr/local/wigo/probes/60/other.pl")
+	if settings.User != "nobody" {
+		t.Fatalf("Invalid user %s, expected %s", settings.User, "nobody")
+	}
+	if settings.MaxCpuTime != 10 {
+		t.Fatalf("Invalid max cpu time %d, expected %d", settings.MaxCpuTime, 10)
+	}
+	if !settings.KeepStderr {
+		t.Fatal("Directory settings have not been applied")
+	}
+
+	settings = config.Probes.Settings("/usr/local/wigo/probes/60/dummy.pl")
+	if settings.User != "wigo" {
+		t.Fatalf("Invalid user %s, expected %s", settings.User, "wigo")
+	}
+	if settings.MaxCpuTime != 20 {
+		t.Fatalf("Invalid max cpu time %d, expected %d", settings.MaxCpuTime, 20)
+	}
+	if settings.MaxStdoutSize != config.Probes.MaxStdoutSize {
+		t.Fatalf("Invalid max stdout size %d, expected %d", settings.MaxStdoutSize, config.Probes.MaxStdoutSize)
+	}
+
+	if config.Probes.User != "nobody" {
+		t.Fatal("Default settings have been modified")
+	}
+}
+
+func TestProbeSettingsEnv(t *testing.T) {
+	config := NewConfig()
+	config.Probes.Env = map[string]string{"FOO": "foo"}
+	config.Probes.Probe["dummy"] = &ProbeSettings{Env: map[string]string{"BAR": "bar"}}
+
+	settings := config.Probes.Settings("/usr/local/wigo/probes/60/dummy.pl")
+	if settings.Env["FOO"] != "foo" || settings.Env["BAR"] != "bar" {
+		t.Fatalf("Invalid probe environment %v", settings.Env)
+	}
+	if _, ok := config.Probes.Env["BAR"]; ok {
+		t.Fatal("Default environment has been modified")
+	}
+}
+
+func TestWatcherInterval(t *testing.T) {
+	config := NewConfig()
+	config.Watcher.Intervals["hourly"] = 3600
+	config.Watcher.Intervals["5m"] = 300
+
+	for directory, expected := range map[string]int{"60": 60, "hourly": 3600, "5m": 300} {
+		interval, ok := config.Watcher.Interval(directory)
+		if !ok {
+			t.Fatalf("Directory %s has no interval", directory)
+		}
+		if interval != expected {
+			t.Fatalf("Invalid interval %d, expected %d", interval, expected)
+		}
+	}
+
+	for _, directory := range []string{"examples", "0", "-60", "daily"} {
+		if _, ok := config.Watcher.Interval(directory); ok {
+			t.Fatalf("Directory %s should not have an interval", directory)
+		}
+	}
+}
+
+func TestWatcherAccept(t *testing.T) {
+	config := NewConfig()
+	for _, name := range []string{"dummy.pl", "check_disk", "dummy.sh"} {
+		if !config.Watcher.Accept(name) {
+			t.Fatalf("Probe %s should be accepted", name)
+		}
+	}
+	for _, name := range []string{".dummy.pl", ".dummy.pl.swp", "dummy.pl~", "dummy.pl.orig", "dummy.pl.dpkg-old", "README.md", "dummy.pl.disabled"} {
+		if config.Watcher.Accept(name) {
+			t.Fatalf("Probe %s should be ignored", name)
+		}
+	}
+
+	config.Watcher.Include = []string{"*.pl"}
+	config.Watcher.Exclude = []string{"test_*"}
+	if !config.Watcher.Accept("dummy.pl") || !config.Watcher.Accept(".dummy.pl") {
+		t.Fatal("Included probe should be accepted")
+	}
+	if config.Watcher.Accept("dummy.sh") || config.Watcher.Accept("test_dummy.pl") {
+		t.Fatal("Probe should be ignored")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	if err := LoadConfig("../../config/wigo.conf"); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := ReloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("Invalid changed sections %v, expected none", changed)
+	}
+
+	old := NewConfig()
+	new := NewConfig()
+	new.Http.Port = 4242
+	new.OpenTSDB.Tags["dc"] = "eu"
+	changed = Diff(old, new)
+	if len(changed) != 2 || changed[0] != "Http" || changed[1] != "OpenTSDB" {
+		t.Fatalf("Invalid changed sections %v, expected %v", changed, []string{"Http", "OpenTSDB"})
+	}
+
+	// Sections only applied on restart keep their running values
+	configFile := "/tmp/wigo_config_reload_test.conf"
+	defer os.Remove(configFile)
+	if err := ioutil.WriteFile(configFile, []byte("[OpenTSDB]\nAddress = [\"tsdb1\"]\n"), 0644); err != nil {
+		t.Fatalf("Unable to write test configuration : %s", err)
+	}
+	if err := LoadConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configFile, []byte("[Http]\nPort = 4242\n[OpenTSDB]\nAddress = [\"tsdb2\"]\n"), 0644); err != nil {
+		t.Fatalf("Unable to write test configuration : %s", err)
+	}
+	if changed, err = ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 2 || changed[0] != "Http" || changed[1] != "OpenTSDB" {
+		t.Fatalf("Invalid changed sections %v, expected %v", changed, []string{"Http", "OpenTSDB"})
+	}
+	if c := GetConfig(); c.Http.Port != 4242 || c.OpenTSDB.Address[0] != "tsdb1" {
+		t.Fatalf("Invalid reloaded configuration : http port %d, OpenTSDB addresses %v", c.Http.Port, c.OpenTSDB.Address)
+	}
+
+	new = NewConfig()
+	new.Watcher.Mode = "foo"
+	if len(new.Validate()) == 0 {
+		t.Fatal("Invalid watcher mode accepted")
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	if _, problems := Check("../../config/wigo.conf"); len(problems) != 0 {
+		t.Fatalf("Invalid default configuration : %s", problems)
+	}
+
+	configFile := "/tmp/wigo_config_test.conf"
+	data := `
+[Global]
+ListenPort = 4000
+
+[Http]
+Port = 70000
+SslEnabled = true
+SslCert = "/nonexistent/wigo.crt"
+SslKey = "/nonexistent/wigo.key"
+
+[Notifications]
+RescueOnly = false
+OnWigoChange = true
+EmailEnabled = 2
+
+[Probes.Probe.dummy]
+Daemon = true
+Mode = "nagios"
+`
+	if err := ioutil.WriteFile(configFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Unable to write test configuration : %s", err)
+	}
+	defer os.Remove(configFile)
+
+	_, problems := Check(configFile)
+	expected := map[string]bool{
+		"Global.ListenPort":             true,
+		"Http.Port":                     false,
+		"Http.SslCert":                  false,
+		"Http.SslKey":                   false,
+		"Notifications.RescueOnly":      true,
+		"Notifications.OnWigoChange":    true,
+		"Notifications.EmailEnabled":    false,
+		"Notifications.EmailSmtpServer": false,
+		"Notifications.EmailRecipients": false,
+		"Probes.Probe.dummy.Daemon":     false,
+	}
+	for _, p := range problems {
+		warning, ok := expected[p.Key]
+		if !ok {
+			t.Fatalf("Unexpected problem %s", p)
+		}
+		if warning != p.Warning {
+			t.Fatalf("Invalid problem level %s, expected warning %t", p, warning)
+		}
+		delete(expected, p.Key)
+	}
+	if len(expected) != 0 {
+		t.Fatalf("Missing problems %v", expected)
+	}
+
+	if err := LoadConfig(configFile); err == nil {
+		t.Fatal("Invalid configuration loaded")
+	}
+}
+
+func TestRemoteWigosPort(t *testing.T) {
+	c := NewConfig()
+	c.Http.Port = 4002
+	c.RemoteWigos.List = []string{"remote1", "remote2:4003"}
+	c.AdvancedList = []AdvancedRemoteWigoConfig{{Hostname: "remote3"}}
+	if problems := c.Validate(); len(problems) != 0 {
+		t.Fatalf("Invalid remote wigos : %s", problems)
+	}
+	c.Initialize()
+
+	expected := []int{4002, 4002, 4003}
+	if len(c.RemoteWigos.AdvancedList) != len(expected) {
+		t.Fatalf("Invalid remote wigos %v", c.RemoteWigos.AdvancedList)
+	}
+	for i, remote := range c.RemoteWigos.AdvancedList {
+		if remote.Port != expected[i] {
+			t.Fatalf("Invalid port %d for %s, expected %d", remote.Port, remote.Hostname, expected[i])
+		}
+	}
+
+	c = NewConfig()
+	c.Http.Port = 0
+	c.RemoteWigos.List = []string{"remote1", "remote2:0"}
+	c.AdvancedList = []AdvancedRemoteWigoConfig{{Hostname: "remote3"}}
+	rejected := map[string]bool{
+		"Http.Port":            true,
+		"RemoteWigos.List[0]":  true,
+		"RemoteWigos.List[1]":  true,
+		"AdvancedList[0].Port": true,
+	}
+	for _, p := range c.Validate() {
+		delete(rejected, p.Key)
+	}
+	if len(rejected) != 0 {
+		t.Fatalf("Port 0 not rejected for %v", rejected)
+	}
+
+	// Configurations still setting the deprecated ListenPort keep using it
+	configFile := "/tmp/wigo_config_test.conf"
+	data := `
+[Global]
+ListenPort = 4005
+
+[RemoteWigos]
+List = ["remote1"]
+`
+	if err := ioutil.WriteFile(configFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Unable to write test configuration : %s", err)
+	}
+	defer os.Remove(configFile)
+
+	c, problems := Check(configFile)
+	if len(problems) != 1 || problems[0].Key != "Global.ListenPort" || !problems[0].Warning {
+		t.Fatalf("Invalid problems %s", problems)
+	}
+	if len(c.RemoteWigos.AdvancedList) != 1 || c.RemoteWigos.AdvancedList[0].Port != 4005 {
+		t.Fatalf("Invalid remote wigos %v, expected port %d", c.RemoteWigos.AdvancedList, 4005)
+	}
+}
+
+func TestConfigOverrides(t *testing.T) {
+	os.Setenv("WIGO_HTTP_PORT", "4001")
+	os.Setenv("WIGO_GLOBAL_HOSTNAME", "env-host")
+	os.Setenv("WIGO_OPENTSDB_TAGS", "dc=eu, env=prod")
+	os.Setenv("WIGO_PROBE_NAME", "dummy")
+	defer os.Unsetenv("WIGO_HTTP_PORT")
+	defer os.Unsetenv("WIGO_GLOBAL_HOSTNAME")
+	defer os.Unsetenv("WIGO_OPENTSDB_TAGS")
+	defer os.Unsetenv("WIGO_PROBE_NAME")
+
+	SetOverrides([]string{"global.hostname=flag-host", "OpenTSDB.Tags.env=dev", "Probes.Probe.dummy.User=nobody", "RemoteWigos.List=a,b:4002"})
+	defer SetOverrides(nil)
+
+	if err := LoadConfig("../../config/wigo.conf"); err != nil {
+		t.Fatal(err)
+	}
+	c := GetConfig()
+	if c.Http.Port != 4001 {
+		t.Fatalf("Invalid http port %d, expected %d", c.Http.Port, 4001)
+	}
+	if c.Global.Hostname != "flag-host" {
+		t.Fatalf("Invalid hostname %s, expected %s", c.Global.Hostname, "flag-host")
+	}
+	if len(c.OpenTSDB.Tags) != 2 || c.OpenTSDB.Tags["dc"] != "eu" || c.OpenTSDB.Tags["env"] != "dev" {
+		t.Fatalf("Invalid OpenTSDB tags %v", c.OpenTSDB.Tags)
+	}
+	if settings := c.Probes.Settings("/usr/local/wigo/probes/60/dummy.pl"); settings.User != "nobody" {
+		t.Fatalf("Invalid user %s, expected %s", settings.User, "nobody")
+	}
+	if len(c.RemoteWigos.AdvancedList) != 2 || c.RemoteWigos.AdvancedList[1].Port != 4002 {
+		t.Fatalf("Invalid remote wigos %v", c.RemoteWigos.AdvancedList)
+	}
+
+	expected := map[string]string{
+		"Http.Port":               "4001 ( env )",
+		"Global.Hostname":         `"flag-host" ( flag )`,
+		"Global.ProbesDirectory":  `"/usr/local/wigo/probes" ( file )`,
+		"Http.Gzip":               "true ( default )",
+		"OpenTSDB.Tags":           `{"dc":"eu","env":"dev"} ( dc: env, env: flag )`,
+		"Probes.Probe.dummy.User": `"nobody" ( flag )`,
+	}
+	for _, line := range dump(c, sources) {
+		splits := strings.SplitN(line, " = ", 2)
+		if value, ok := expected[splits[0]]; ok && value != "" && value != splits[1] {
+			t.Fatalf("Invalid dump of %s : %s, expected %s", splits[0], splits[1], value)
+		}
+	}
+	if !strings.HasSuffix(dumpLine(c, "RemoteWigos.AdvancedList"), "( flag )") {
+		t.Fatalf("Invalid dump %s", dumpLine(c, "RemoteWigos.AdvancedList"))
+	}
+
+	SetOverrides([]string{"Http.Port=foo", "Http.Nothing=1"})
+	_, problems := Check("../../config/wigo.conf")
+	if len(problems) != 2 || problems[0].Key != "Http.Port" || problems[1].Key != "Http.Nothing" {
+		t.Fatalf("Invalid problems %s", problems)
+	}
+}
+
+func dumpLine(c *Config, key string) string {
+	for _, line := range dump(c, sources) {
+		if strings.HasPrefix(line, key+" = ") {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestConfigFragments(t *testing.T) {
+	configFile := "/tmp/wigo_config_test.conf"
+	includeDirectory := IncludeDirectory(configFile)
+	if err := os.RemoveAll(includeDirectory); err != nil {
+		t.Fatalf("Unable to remove test include directory %s : %s", includeDirectory, err)
+	}
+	if err := os.Mkdir(includeDirectory, 0755); err != nil {
+		t.Fatalf("Unable to create test include directory %s : %s", includeDirectory, err)
+	}
+	defer os.RemoveAll(includeDirectory)
+	defer os.Remove(configFile)
+
+	files := map[string]string{
+		configFile: `
+[Http]
+Port = 4001
+
+[OpenTSDB]
+Address = ["tsdb1"]
+[OpenTSDB.Tags]
+dc = "eu"
+
+[RemoteWigos]
+List = ["a"]
+`,
+		includeDirectory + "/10-team.conf": `
+[Http]
+Port = 4002
+
+[OpenTSDB]
+Address = ["tsdb2"]
+[OpenTSDB.Tags]
+team = "infra"
+
+[RemoteWigos]
+List = ["b:4003"]
+
+[[AdvancedList]]
+Hostname = "c"
+`,
+		includeDirectory + "/20-host.conf": `
+[Http]
+Port = 4004
+
+[OpenTSDB.Tags]
+dc = "us"
+`,
+		includeDirectory + "/.30-hidden.conf": `
+[Http]
+Port = 4005
+`,
+		includeDirectory + "/README": `not a fragment`,
+	}
+	for path, data := range files {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Unable to write test configuration %s : %s", path, err)
+		}
+	}
+
+	if err := LoadConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+	c := GetConfig()
+
+	// The last fragment wins
+	if c.Http.Port != 4004 {
+		t.Fatalf("Invalid http port %d, expected %d", c.Http.Port, 4004)
+	}
+
+	// Other lists are replaced
+	if len(c.OpenTSDB.Address) != 1 || c.OpenTSDB.Address[0] != "tsdb2" {
+		t.Fatalf("Invalid OpenTSDB addresses %v, expected %v", c.OpenTSDB.Address, []string{"tsdb2"})
+	}
+
+	// Maps are merged
+	if len(c.OpenTSDB.Tags) != 2 || c.OpenTSDB.Tags["dc"] != "us" || c.OpenTSDB.Tags["team"] != "infra" {
+		t.Fatalf("Invalid OpenTSDB tags %v", c.OpenTSDB.Tags)
+	}
+
+	// Remote wigos lists are appended
+	remotes := []string{}
+	for _, remote := range c.RemoteWigos.AdvancedList {
+		remotes = append(remotes, remote.Hostname)
+	}
+	if strings.Join(remotes, ",") != "c,a,b" {
+		t.Fatalf("Invalid remote wigos %v, expected %v", remotes, []string{"c", "a", "b"})
+	}
+
+	expected := map[string]string{
+		"Http.Port":        "4004 ( file:20-host.conf )",
+		"Http.Address":     `"0.0.0.0" ( default )`,
+		"OpenTSDB.Tags":    `{"dc":"us","team":"infra"} ( file, file:10-team.conf, file:20-host.conf )`,
+		"RemoteWigos.List": `["a","b:4003"] ( file, file:10-team.conf )`,
+	}
+	for _, line := range dump(c, sources) {
+		splits := strings.SplitN(line, " = ", 2)
+		if value, ok := expected[splits[0]]; ok && value != "" && value != splits[1] {
+			t.Fatalf("Invalid dump of %s : %s, expected %s", splits[0], splits[1], value)
+		}
+	}
+
+	// Overrides come after the fragments
+	SetOverrides([]string{"Http.Port=4006", "OpenTSDB.Tags.team=ops"})
+	defer SetOverrides(nil)
+	if c, _ = Check(configFile); c.Http.Port != 4006 {
+		t.Fatalf("Invalid http port %d, expected %d", c.Http.Port, 4006)
+	}
+
+	// Overridden map entries keep their own source
+	if err := LoadConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+	line := dumpLine(GetConfig(), "OpenTSDB.Tags")
+	if !strings.HasSuffix(line, "( dc: file:20-host.conf, team: flag )") {
+		t.Fatalf("Invalid dump %s", line)
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Lists appended to by the configuration fragments instead of being replaced
+var appendedLists = []string{
+	"RemoteWigos.List",
+	"AdvancedList",
+}
+
+// configPart is a configuration file decoded into the configuration,
+// either the main configuration file or one of its fragments
+type configPart struct {
+	path   string
+	source string
+	md     toml.MetaData
+}
+
+// IncludeDirectory return the directory holding the configuration
+// fragments of a configuration file ( eg : /etc/wigo/wigo.conf.d )
+func IncludeDirectory(configFile string) string {
+	return configFile + ".d"
+}
+
+// fragments return the paths of the configuration fragments of a
+// configuration file in lexical order, hidden files are ignored
+func fragments(configFile string) (paths []string, err error) {
+	matches, err := filepath.Glob(filepath.Join(IncludeDirectory(configFile), "*.conf"))
+	for _, path := range matches {
+		if !strings.HasPrefix(filepath.Base(path), ".") {
+			paths = append(paths, path)
+		}
+	}
+	return
+}
+
+// decodeFiles decode a configuration file and then its fragments into c
+func (c *Config) decodeFiles(configFile string) (parts []*configPart, err error) {
+	paths, err := fragments(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %s : %s", IncludeDirectory(configFile), err)
+	}
+
+	parts = []*configPart{{path: configFile, source: SourceFile}}
+	for _, path := range paths {
+		parts = append(parts, &configPart{path: path, source: SourceFile + ":" + filepath.Base(path)})
+	}
+	for _, part := range parts {
+		if part.md, err = c.decode(part.path); err != nil {
+			return nil, fmt.Errorf("unable to parse %s : %s", part.path, err)
+		}
+	}
+	return
+}
+
+// decode a configuration file into c. Values override the values
+// already set, map entries are added to the maps and the appended
+// lists are appended to.
+func (c *Config) decode(path string) (md toml.MetaData, err error) {
+	v := reflect.ValueOf(c)
+	saved := make(map[string]reflect.Value)
+	for _, key := range appendedLists {
+		list := lookup(v, key)
+		saved[key] = reflect.ValueOf(list.Interface())
+		list.Set(reflect.Zero(list.Type()))
+	}
+
+	md, err = toml.DecodeFile(path, c)
+
+	for _, key := range appendedLists {
+		list := lookup(v, key)
+		if err == nil && md.IsDefined(strings.Split(key, ".")...) {
+			list.Set(reflect.AppendSlice(saved[key], list))
+		} else {
+			list.Set(saved[key])
+		}
+	}
+	return
+}
+
+// lookup return the field of the configuration at path
+func lookup(v reflect.Value, path string) reflect.Value {
+	for _, key := range strings.Split(path, ".") {
+		v = reflect.Indirect(v).FieldByName(key)
+	}
+	return v
+}
+
+// appended return true if the values of the configuration
+// at path are merged from every configuration file
+func appended(path string, v reflect.Value) bool {
+	if v.Kind() == reflect.Map {
+		return true
+	}
+	for _, key := range appendedLists {
+		if key == path {
+			return true
+		}
+	}
+	return false
+}
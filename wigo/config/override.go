@@ -0,0 +1,374 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source of a configuration value, by increasing precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Prefix of the environment variables overriding configuration
+// keys ( eg : WIGO_HTTP_PORT overrides Http.Port )
+const EnvPrefix = "WIGO_"
+
+// rank return the precedence of a source, configuration
+// files and fragments ( "file:10-remote.conf" ) are ranked alike
+func rank(source string) int {
+	switch {
+	case source == SourceFlag:
+		return 3
+	case source == SourceEnv:
+		return 2
+	case strings.HasPrefix(source, SourceFile):
+		return 1
+	}
+	return 0
+}
+
+var errUnknownKey = errors.New("unknown key")
+
+// Overrides given on the command line as key=value
+var flagOverrides []string
+
+// Source of every value of the application configuration by key path
+var sources map[string]string
+
+// SetOverrides set the key=value overrides given on the command line
+// ( eg : "Http.Port=4001" ). They are applied after the configuration
+// file and the environment every time the configuration is loaded.
+func SetOverrides(overrides []string) {
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	flagOverrides = overrides
+}
+
+// override apply the environment variables and then the command line
+// overrides to c. The source of every overridden key is recorded.
+//
+// Environment variables set scalars, lists ( "a,b" ) and maps ( "k=v,k2=v2" )
+// of the sections, command line overrides may also set a single map entry
+// ( eg : "OpenTSDB.Tags.dc=eu" or "Probes.Probe.dummy.User=nobody" ).
+func (c *Config) override(overridden map[string]string) (problems Problems) {
+	environ := os.Environ()
+	sort.Strings(environ)
+	for _, variable := range environ {
+		if !strings.HasPrefix(variable, EnvPrefix) {
+			continue
+		}
+		splits := strings.SplitN(variable, "=", 2)
+		keys := strings.Split(strings.TrimPrefix(splits[0], EnvPrefix), "_")
+
+		// Probes are given WIGO_* variables that are not configuration keys
+		path, err := setValue(reflect.ValueOf(c), keys, splits[1], false)
+		if err == errUnknownKey {
+			log.Debugf("Environment variable %s is not a configuration key", splits[0])
+			continue
+		}
+		if err != nil {
+			problems.add(path, "invalid value of %s : %s", splits[0], err)
+			continue
+		}
+		c.overridden(overridden, path, SourceEnv)
+	}
+
+	for _, override := range flagOverrides {
+		splits := strings.SplitN(override, "=", 2)
+		if len(splits) != 2 {
+			problems.add("", "invalid override %s, expected key=value", override)
+			continue
+		}
+		path, err := setValue(reflect.ValueOf(c), strings.Split(splits[0], "."), splits[1], true)
+		if err == errUnknownKey {
+			problems.add(splits[0], "unknown key")
+			continue
+		}
+		if err != nil {
+			problems.add(path, "invalid value %s : %s", splits[1], err)
+			continue
+		}
+		c.overridden(overridden, path, SourceFlag)
+	}
+	return
+}
+
+// overridden record the source of an overridden key. Setting a whole
+// map records the source of each of its entries, replacing the sources
+// of the entries overridden before ( eg : OpenTSDB.Tags.dc ).
+func (c *Config) overridden(overridden map[string]string, path string, source string) {
+	for key := range overridden {
+		if strings.HasPrefix(key, path+".") {
+			delete(overridden, key)
+		}
+	}
+	overridden[path] = source
+	walk(reflect.ValueOf(c), "", func(p string, v reflect.Value) {
+		if p == path && v.Kind() == reflect.Map {
+			for _, key := range v.MapKeys() {
+				overridden[joinPath(path, key.String())] = source
+			}
+		}
+	})
+}
+
+// setValue set the key at path keys of v from its string representation
+// and return the path of the key as named in the configuration. Map
+// entries are only set if entries is true, otherwise maps are replaced.
+func setValue(v reflect.Value, keys []string, value string, entries bool) (path string, err error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), keys, value, entries)
+	}
+	if len(keys) == 0 {
+		return "", parseValue(v, value)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok := v.Type().FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, keys[0]) })
+		if !ok || field.PkgPath != "" || keys[0] == "" {
+			return "", errUnknownKey
+		}
+		path, err = setValue(v.FieldByIndex(field.Index), keys[1:], value, entries)
+		return joinPath(field.Name, path), err
+	case reflect.Map:
+		if !entries || v.Type().Key().Kind() != reflect.String {
+			return "", errUnknownKey
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(keys[0])
+		entry := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(key); existing.IsValid() {
+			entry.Set(existing)
+		}
+		if path, err = setValue(entry, keys[1:], value, entries); err == nil {
+			v.SetMapIndex(key, entry)
+		}
+		return joinPath(keys[0], path), err
+	}
+	return "", errUnknownKey
+}
+
+// parseValue set v from its string representation. Lists are
+// comma separated, maps are comma separated key=value pairs.
+func parseValue(v reflect.Value, value string) (err error) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s is not a boolean", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s is not an integer", value)
+		}
+		v.SetInt(int64(i))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		list := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		m := reflect.MakeMap(v.Type())
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			splits := strings.SplitN(item, "=", 2)
+			if len(splits) != 2 {
+				return fmt.Errorf("%s is not a key=value pair", item)
+			}
+			entry := reflect.New(v.Type().Elem()).Elem()
+			if err = parseValue(entry, strings.TrimSpace(splits[1])); err != nil {
+				return
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(splits[0])), entry)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return
+}
+
+// valueSources return the source of every value of c : the last
+// configuration file defining it, or every configuration file defining
+// it for merged maps and lists, unless it has been overridden.
+func (c *Config) valueSources(parts []*configPart, overridden map[string]string) (sources map[string]string) {
+	sources = make(map[string]string)
+	walk(reflect.ValueOf(c), "", func(path string, v reflect.Value) {
+		defined := definedIn(parts, path)
+		switch {
+		case len(defined) == 0:
+			sources[path] = SourceDefault
+		case appended(path, v):
+			sources[path] = strings.Join(defined, ", ")
+		default:
+			sources[path] = defined[len(defined)-1]
+		}
+	})
+	entries := make(map[string]bool)
+	for path, source := range overridden {
+		// Map entries are dumped with their map ( eg : OpenTSDB.Tags.dc )
+		entry := path
+		for strings.Contains(path, ".") {
+			if _, ok := sources[path]; ok {
+				break
+			}
+			path = path[:strings.LastIndex(path, ".")]
+		}
+		if entry != path {
+			sources[entry] = source
+			entries[path] = true
+		}
+		if rank(source) > rank(sources[path]) {
+			sources[path] = source
+		}
+	}
+
+	// The other entries of the overridden maps come from the files
+	walk(reflect.ValueOf(c), "", func(path string, v reflect.Value) {
+		if !entries[path] {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			entry := joinPath(path, key.String())
+			if _, ok := sources[entry]; ok {
+				continue
+			}
+			sources[entry] = SourceDefault
+			if defined := definedIn(parts, entry); len(defined) > 0 {
+				sources[entry] = defined[len(defined)-1]
+			}
+		}
+	})
+
+	// Initialize builds RemoteWigos.AdvancedList from both remote wigo lists
+	for _, path := range []string{"AdvancedList", "RemoteWigos.List"} {
+		if rank(sources[path]) > rank(sources["RemoteWigos.AdvancedList"]) {
+			sources["RemoteWigos.AdvancedList"] = sources[path]
+		}
+	}
+	return
+}
+
+// definedIn return the sources of the configuration files defining path
+func definedIn(parts []*configPart, path string) (defined []string) {
+	for _, part := range parts {
+		if part.md.IsDefined(strings.Split(path, ".")...) {
+			defined = append(defined, part.source)
+		}
+	}
+	return
+}
+
+// walk call fn for every value of the configuration with its key path.
+// Structs and maps of structs are walked, other values are leaves.
+func walk(v reflect.Value, path string, fn func(path string, v reflect.Value)) {
+	switch {
+	case v.Kind() == reflect.Ptr && !v.IsNil():
+		walk(v.Elem(), path, fn)
+	case v.Kind() == reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Anonymous {
+				walk(v.Field(i), path, fn)
+			} else {
+				walk(v.Field(i), joinPath(path, field.Name), fn)
+			}
+		}
+	case v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.Ptr:
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walk(v.MapIndex(reflect.ValueOf(key)), joinPath(path, key), fn)
+		}
+	default:
+		fn(path, v)
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	if key == "" {
+		return path
+	}
+	return path + "." + key
+}
+
+// dump return a line per value of c with its source. Maps
+// with overridden entries are dumped with the source of each entry.
+func dump(c *Config, sources map[string]string) (lines []string) {
+	walk(reflect.ValueOf(c), "", func(path string, v reflect.Value) {
+		source, ok := sources[path]
+		if !ok {
+			source = SourceDefault
+		}
+		if v.Kind() == reflect.Map {
+			if entries := entrySources(path, v, sources); entries != "" {
+				source = entries
+			}
+		}
+		value, _ := json.Marshal(v.Interface())
+		lines = append(lines, fmt.Sprintf("%s = %s ( %s )", path, value, source))
+	})
+	return
+}
+
+// entrySources return the sources of the entries of a map
+// ( eg : "dc: env, env: flag" ) if they have been recorded
+func entrySources(path string, v reflect.Value, sources map[string]string) string {
+	keys := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+
+	var entries []string
+	for _, key := range keys {
+		source, ok := sources[joinPath(path, key)]
+		if !ok {
+			return ""
+		}
+		entries = append(entries, key+": "+source)
+	}
+	return strings.Join(entries, ", ")
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Path of the configuration file loaded by LoadConfig
+var configFile string
+
+var configLock sync.Mutex
+
+// Sections only applied when the agent starts. Their running values
+// are kept when the configuration is reloaded so the configuration
+// reported matches the one in use.
+var restartSections = []string{"RemoteWigos", "PushServer", "PushClient", "Notifications", "OpenTSDB"}
+
+// ReloadConfig parse the configuration file again and replace the
+// application configuration if it is valid. The sections that changed
+// ( eg : "Http", "OpenTSDB" ) are returned so only the subsystems
+// depending on them are restarted. The sections only applied on
+// restart keep their running values. The running configuration is
+// kept on error.
+func ReloadConfig() (changed []string, err error) {
+	if configFile == "" {
+		return nil, fmt.Errorf("No configuration file loaded")
+	}
+
+	c, s, problems := load(configFile)
+	problems.Log(configFile)
+	if errors := problems.Errors(); len(errors) > 0 {
+		return nil, errors
+	}
+
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	changed = Diff(config, c)
+	for _, section := range changed {
+		if RestartRequired(section) {
+			keepSection(section, config, sources, c, s)
+		}
+	}
+	config = c
+	sources = s
+	return
+}
+
+// RestartRequired return true if changes to a section
+// of the configuration are only applied on restart
+func RestartRequired(section string) bool {
+	for _, name := range restartSections {
+		if name == section {
+			return true
+		}
+	}
+	return false
+}
+
+// keepSection copy a section of the old configuration
+// and the sources of its values into the new one
+func keepSection(section string, old *Config, oldSources map[string]string, new *Config, newSources map[string]string) {
+	reflect.ValueOf(new).Elem().FieldByName(section).Set(reflect.ValueOf(old).Elem().FieldByName(section))
+	for path := range newSources {
+		if path == section || strings.HasPrefix(path, section+".") {
+			delete(newSources, path)
+		}
+	}
+	for path, source := range oldSources {
+		if path == section || strings.HasPrefix(path, section+".") {
+			newSources[path] = source
+		}
+	}
+}
+
+// Diff return the names of the sections of the configuration
+// that differ between old and new
+func Diff(old *Config, new *Config) (changed []string) {
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(new).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changed = append(changed, oldValue.Type().Field(i).Name)
+		}
+	}
+	return
+}
@@ -0,0 +1,359 @@
+package config
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Deprecated keys and the keys replacing them
+var deprecatedKeys = map[string]string{
+	"Global.ListenAddress":       "Http.Address",
+	"Global.ListenPort":          "Http.Port",
+	"Notifications.OnWigoChange": "Notifications.OnHostChange",
+}
+
+// Problem is an error or a warning found in the configuration.
+// Key is the path of the key ( eg : "Http.Port" ), it is empty
+// if the configuration file can't be parsed.
+type Problem struct {
+	Key     string
+	Message string
+	Warning bool
+}
+
+func (p *Problem) String() string {
+	if p.Key == "" {
+		return p.Message
+	}
+	return p.Key + " : " + p.Message
+}
+
+// Problems is the list of problems found in the configuration. It is
+// used as the error returned when the configuration has errors.
+type Problems []*Problem
+
+// Errors return the problems that are not warnings
+func (ps Problems) Errors() (errors Problems) {
+	for _, p := range ps {
+		if !p.Warning {
+			errors = append(errors, p)
+		}
+	}
+	return
+}
+
+func (ps Problems) Error() string {
+	messages := make([]string, 0, len(ps))
+	for _, p := range ps {
+		messages = append(messages, p.String())
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Log every problem, warnings as warnings and others as errors
+func (ps Problems) Log(configFile string) {
+	for _, p := range ps {
+		if p.Warning {
+			log.Warnf("Configuration %s : %s", configFile, p)
+		} else {
+			log.Errorf("Configuration %s : %s", configFile, p)
+		}
+	}
+}
+
+func (ps *Problems) add(key string, format string, args ...interface{}) {
+	*ps = append(*ps, &Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (ps *Problems) warn(key string, format string, args ...interface{}) {
+	*ps = append(*ps, &Problem{Key: key, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+func (ps *Problems) port(key string, port int) {
+	if port < 1 || port > 65535 {
+		ps.add(key, "port %d is out of range ( 1-65535 )", port)
+	}
+}
+
+func (ps *Problems) file(key string, path string) {
+	if path == "" {
+		ps.add(key, "file is not set")
+	} else if _, err := os.Stat(path); err != nil {
+		ps.add(key, "unable to read %s : %s", path, err)
+	}
+}
+
+func (ps *Problems) positive(key string, value int) {
+	if value <= 0 {
+		ps.add(key, "%d must be greater than 0", value)
+	}
+}
+
+func (ps *Problems) globs(key string, patterns []string) {
+	for i, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			ps.add(fmt.Sprintf("%s[%d]", key, i), "invalid pattern %s : %s", pattern, err)
+		}
+	}
+}
+
+// Check parse and validate a configuration file. The configuration
+// is only usable if none of the problems is an error.
+func Check(configFile string) (c *Config, problems Problems) {
+	c, _, problems = load(configFile)
+	return
+}
+
+// load parse a configuration file and its fragments, apply the overrides
+// and validate the result. The source of every value is returned along with it.
+//
+// The main configuration file is decoded first, then the fragments of its include
+// directory in lexical order. A fragment overrides the values set before it, adds
+// entries to maps ( replacing the entries with the same key ) and appends to the
+// appended lists. Environment variables and then command line overrides come last.
+func load(configFile string) (c *Config, sources map[string]string, problems Problems) {
+	c = NewConfig()
+	parts, err := c.decodeFiles(configFile)
+	if err != nil {
+		problems.add("", "%s", err)
+		return
+	}
+
+	for _, part := range parts {
+		where := ""
+		if part.path != configFile {
+			where = " in " + part.path
+		}
+		ignored := make(map[string]bool)
+		for _, key := range part.md.Undecoded() {
+			ignored[key.String()] = true
+			if replacement, ok := deprecatedKeys[key.String()]; ok {
+				problems.warn(key.String(), "deprecated and ignored%s, use %s", where, replacement)
+			} else {
+				problems.warn(key.String(), "unknown key%s, ignored", where)
+			}
+		}
+		for _, key := range sortedKeys(deprecatedKeys) {
+			if part.md.IsDefined(strings.Split(key, ".")...) && !ignored[key] {
+				problems.warn(key, "deprecated%s, use %s", where, deprecatedKeys[key])
+			}
+		}
+	}
+
+	overridden := make(map[string]string)
+	problems = append(problems, c.override(overridden)...)
+	sources = c.valueSources(parts, overridden)
+
+	problems = append(problems, c.Validate()...)
+	c.Initialize()
+	return
+}
+
+// Validate check the values of a configuration as decoded from
+// the configuration file, before it is initialized
+func (c *Config) Validate() (problems Problems) {
+	// Global
+	if c.Global.ProbesDirectory == "" {
+		problems.add("Global.ProbesDirectory", "probes directory is not set")
+	}
+	problems.positive("Global.AliveTimeout", c.Global.AliveTimeout)
+
+	// Http
+	problems.port("Http.Port", c.Http.Port)
+	if c.Http.Enabled && c.Http.SslEnabled {
+		problems.file("Http.SslCert", c.Http.SslCert)
+		problems.file("Http.SslKey", c.Http.SslKey)
+	}
+	if c.Http.Login == "" && c.Http.Password != "" {
+		problems.add("Http.Password", "password is set without Http.Login, authentication is disabled")
+	}
+	if c.Http.Login != "" && c.Http.Password == "" {
+		problems.warn("Http.Password", "empty password for login %s", c.Http.Login)
+	}
+
+	// Push server and client
+	problems.port("PushServer.Port", c.PushServer.Port)
+	if c.PushServer.Enabled {
+		if c.PushServer.SslEnabled {
+			problems.file("PushServer.SslCert", c.PushServer.SslCert)
+			problems.file("PushServer.SslKey", c.PushServer.SslKey)
+		}
+		if c.Http.Enabled && c.PushServer.Port == c.Http.Port {
+			problems.add("PushServer.Port", "port %d is already used by Http.Port", c.PushServer.Port)
+		}
+	}
+	problems.port("PushClient.Port", c.PushClient.Port)
+	if c.PushClient.Enabled {
+		if c.PushClient.Address == "" {
+			problems.add("PushClient.Address", "push server address is not set")
+		}
+		if c.PushClient.SslEnabled {
+			problems.file("PushClient.SslCert", c.PushClient.SslCert)
+		}
+		problems.positive("PushClient.PushInterval", c.PushClient.PushInterval)
+	}
+
+	// Remote wigos
+	problems.positive("RemoteWigos.CheckInterval", c.RemoteWigos.CheckInterval)
+	problems.positive("RemoteWigos.CheckTries", c.RemoteWigos.CheckTries)
+	for i, remote := range c.RemoteWigos.List {
+		key := fmt.Sprintf("RemoteWigos.List[%d]", i)
+		splits := strings.Split(remote, ":")
+		if splits[0] == "" {
+			problems.add(key, "hostname is not set")
+		}
+		if len(splits) == 1 {
+			problems.port(key, c.remotePort(0))
+		} else if port, err := strconv.Atoi(splits[1]); err != nil {
+			problems.add(key, "invalid port %s", splits[1])
+		} else {
+			problems.port(key, port)
+		}
+	}
+	for i, remote := range c.AdvancedList {
+		key := fmt.Sprintf("AdvancedList[%d]", i)
+		if remote.Hostname == "" {
+			problems.add(key+".Hostname", "hostname is not set")
+		}
+		problems.port(key+".Port", c.remotePort(remote.Port))
+	}
+
+	// Notifications
+	if c.Notifications.MinLevelToSend < 100 || c.Notifications.MinLevelToSend > 999 {
+		problems.add("Notifications.MinLevelToSend", "level %d is out of range ( 100-999 )", c.Notifications.MinLevelToSend)
+	}
+	switch c.Notifications.HttpEnabled {
+	case 0:
+	case 1:
+		if u, err := url.Parse(c.Notifications.HttpUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			problems.add("Notifications.HttpUrl", "invalid url %q", c.Notifications.HttpUrl)
+		}
+	default:
+		problems.add("Notifications.HttpEnabled", "invalid value %d ( 0: disabled, 1: enabled )", c.Notifications.HttpEnabled)
+	}
+	switch c.Notifications.EmailEnabled {
+	case 0:
+	case 1, 2:
+		if c.Notifications.EmailEnabled == 2 && c.Notifications.HttpEnabled == 0 {
+			problems.add("Notifications.EmailEnabled", "emails are only sent if http failed but Notifications.HttpEnabled is 0")
+		}
+		if c.Notifications.EmailSmtpServer == "" {
+			problems.add("Notifications.EmailSmtpServer", "smtp server is not set")
+		}
+		if len(c.Notifications.EmailRecipients) == 0 {
+			problems.add("Notifications.EmailRecipients", "no recipient")
+		}
+	default:
+		problems.add("Notifications.EmailEnabled", "invalid value %d ( 0: disabled, 1: enabled, 2: only if http failed )", c.Notifications.EmailEnabled)
+	}
+
+	// OpenTSDB
+	if c.OpenTSDB.Enabled {
+		if len(c.OpenTSDB.Address) == 0 {
+			problems.add("OpenTSDB.Address", "no OpenTSDB address")
+		}
+		problems.positive("OpenTSDB.BufferSize", c.OpenTSDB.BufferSize)
+	}
+	if c.OpenTSDB.Deduplication < 0 {
+		problems.add("OpenTSDB.Deduplication", "%d must not be negative", c.OpenTSDB.Deduplication)
+	}
+
+	// Probes
+	problems = append(problems, c.Probes.ProbeSettings.validate("Probes")...)
+	for _, name := range sortedKeys(c.Probes.Directory) {
+		if _, ok := c.Watcher.Interval(name); !ok {
+			problems.warn("Probes.Directory."+name, "%s is not a probe directory interval", name)
+		}
+		problems = append(problems, c.Probes.Directory[name].validate("Probes.Directory."+name)...)
+	}
+	for _, name := range sortedKeys(c.Probes.Probe) {
+		problems = append(problems, c.Probes.Probe[name].validate("Probes.Probe."+name)...)
+	}
+
+	// Watcher
+	switch c.Watcher.Mode {
+	case WatcherAuto, WatcherInotify, WatcherPolling:
+	default:
+		problems.add("Watcher.Mode", "invalid mode %s ( %s, %s or %s )", c.Watcher.Mode, WatcherAuto, WatcherInotify, WatcherPolling)
+	}
+	problems.positive("Watcher.PollInterval", c.Watcher.PollInterval)
+	if c.Watcher.Debounce < 0 {
+		problems.add("Watcher.Debounce", "%d must not be negative", c.Watcher.Debounce)
+	}
+	for _, name := range sortedKeys(c.Watcher.Intervals) {
+		problems.positive("Watcher.Intervals."+name, c.Watcher.Intervals[name])
+	}
+	problems.globs("Watcher.Include", c.Watcher.Include)
+	problems.globs("Watcher.Exclude", c.Watcher.Exclude)
+
+	// Passive probes
+	if c.Passive.Enabled && c.Passive.Socket == "" {
+		problems.add("Passive.Socket", "socket is not set")
+	}
+	problems.positive("Passive.DefaultTtl", c.Passive.DefaultTtl)
+	return
+}
+
+// validate check probe settings, key is the path of the settings.
+// Empty values are allowed as they do not override the defaults.
+func (this *ProbeSettings) validate(key string) (problems Problems) {
+	switch this.Mode {
+	case "", "wigo", "nagios":
+	default:
+		problems.add(key+".Mode", "invalid mode %s ( wigo or nagios )", this.Mode)
+	}
+	switch this.Input {
+	case "", "none", "json":
+	default:
+		problems.add(key+".Input", "invalid input %s ( none or json )", this.Input)
+	}
+	if this.Daemon && this.Mode == "nagios" {
+		problems.add(key+".Daemon", "daemon probes can't use the nagios mode")
+	}
+
+	limits := map[string]int{
+		"StaleWindow":   this.StaleWindow,
+		"MaxStdoutSize": this.MaxStdoutSize,
+		"MaxStderrSize": this.MaxStderrSize,
+		"MaxCpuTime":    this.MaxCpuTime,
+		"MaxMemory":     this.MaxMemory,
+		"MaxOpenFiles":  this.MaxOpenFiles,
+		"MaxProcesses":  this.MaxProcesses,
+	}
+	for _, name := range sortedKeys(limits) {
+		if limits[name] < 0 {
+			problems.add(key+"."+name, "%d must not be negative", limits[name])
+		}
+	}
+	if this.Nice < -20 || this.Nice > 19 {
+		problems.add(key+".Nice", "niceness %d is out of range ( -20-19 )", this.Nice)
+	}
+	return
+}
+
+// sortedKeys return the keys of a map sorted, so problems
+// are always reported in the same order
+func sortedKeys(m interface{}) (keys []string) {
+	switch m := m.(type) {
+	case map[string]*ProbeSettings:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]int:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]string:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
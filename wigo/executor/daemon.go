@@ -0,0 +1,272 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	wigoUtils "github.com/root-gg/wigo/wigo/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Delay between restarts of a daemon probe. The delay doubles on every
+// restart and is reset once the probe has been running for the maximum
+// delay.
+var daemonMinBackoff = time.Second
+var daemonMaxBackoff = time.Minute
+
+// runDaemon keep a daemon probe running and publish every result it
+// writes to stdout, one JSON result per line. The probe is restarted
+// if it exits, until the executor is shut down or the probe removed.
+// The probe is not started while it is disabled by its config.
+func (pe *ProbeExecutor) runDaemon() {
+	backoff := daemonMinBackoff
+	paused := false
+	for {
+		if _, err := os.Lstat(pe.Path); os.IsNotExist(err) {
+			log.Infof("Probe %s has been removed", pe.Path)
+			pe.deleteState()
+			pe.Shutdown()
+			return
+		}
+
+		if pe.disabled() {
+			if !paused {
+				select {
+				case <-pe.stop:
+					return
+				case pe.Results <- pe.disabledResult():
+				}
+			}
+			paused = true
+			select {
+			case <-pe.stop:
+				return
+			case <-pe.wake:
+			case <-time.After(pe.staleWindow()):
+			}
+			continue
+		}
+		paused = false
+
+		started := time.Now()
+		result := pe.executeDaemon()
+		if result == nil || !pe.publish(result) {
+			return
+		}
+
+		if time.Since(started) > daemonMaxBackoff {
+			backoff = daemonMinBackoff
+		}
+		log.Warnf("Daemon probe %s restarting in %s", pe.Path, backoff)
+		select {
+		case <-pe.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > daemonMaxBackoff {
+			backoff = daemonMaxBackoff
+		}
+	}
+}
+
+// publish a result, return false if the executor has been shut down
+func (pe *ProbeExecutor) publish(result *ProbeResult) bool {
+	result.Path = pe.Path
+	result.Name = pe.Key
+	pe.tag(result)
+
+	// Stale results are published by the executor itself
+	// if the probe stays silent during the stale window
+	result.Ttl = 2*int(pe.staleWindow().Seconds()) + staleGrace
+
+	pe.lock.Lock()
+	pe.previous = result
+	pe.lock.Unlock()
+
+	select {
+	case <-pe.stop:
+		return false
+	case pe.Results <- result:
+		return true
+	}
+}
+
+// staleWindow return the delay without result after
+// which a daemon probe is considered stale
+func (pe *ProbeExecutor) staleWindow() time.Duration {
+	if pe.Settings.StaleWindow > 0 {
+		return time.Duration(pe.Settings.StaleWindow) * time.Second
+	}
+	return time.Duration(pe.Timeout) * time.Second
+}
+
+// executeDaemon run a daemon probe until it exits and return a
+// ProbeResult describing why. Nil is returned if the executor has
+// been shut down.
+func (pe *ProbeExecutor) executeDaemon() (probeResult *ProbeResult) {
+	log.Debugf("Starting daemon probe %s", pe.Name)
+
+	reader, writer := io.Pipe()
+	stderr := NewOutputBuffer(pe.Settings.MaxStderrSize)
+	cmd, probeResult := pe.start(writer, stderr)
+	if probeResult != nil {
+		writer.Close()
+		return
+	}
+
+	// Read results line by line
+	lines := make(chan *daemonLine)
+	go func() {
+		defer close(lines)
+		if err := readLines(reader, pe.Settings.MaxStdoutSize, lines); err != nil {
+			log.Warnf("Unable to read daemon probe %s output : %s", pe.Path, err)
+		}
+
+		// Never block the probe
+		io.Copy(ioutil.Discard, reader)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		writer.Close()
+		done <- err
+	}()
+
+	// Kill the probe when the executor is shut down. Pending
+	// lines are discarded so the probe can be waited for.
+	output := lines
+	kill := func() *ProbeResult {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		go func() {
+			for range output {
+			}
+		}()
+		<-done
+		return nil
+	}
+
+	window := pe.staleWindow()
+	stale := time.NewTimer(window)
+	defer stale.Stop()
+
+	for {
+		select {
+		case <-pe.stop:
+			return kill()
+		case line, ok := <-lines:
+			if !ok {
+				// Wait for the probe to exit
+				lines = nil
+				continue
+			}
+			result := pe.daemonResult(line)
+			if result == nil {
+				continue
+			}
+			stale.Reset(window)
+			if !pe.publish(result) {
+				return kill()
+			}
+		case <-stale.C:
+			log.Warnf("Daemon probe %s is stale", pe.Path)
+			if !pe.publish(NewProbeResult(wigoUtils.StatusStale, -1, fmt.Sprintf("No result received for %s", window), "")) {
+				return kill()
+			}
+			stale.Reset(window)
+		case err := <-done:
+			// Publish the results written before exiting
+			for line := range output {
+				if result := pe.daemonResult(line); result != nil && !pe.publish(result) {
+					go func() {
+						for range output {
+						}
+					}()
+					return nil
+				}
+			}
+			pe.updateStats(stderr)
+
+			if status, message := pe.limitViolation(cmd.ProcessState, stderr.Bytes()); err != nil && status != 0 {
+				log.Warnf("Daemon probe %s killed : %s", pe.Path, message)
+				probeResult = NewProbeResult(status, -1, message, "")
+			} else {
+				exitCode := exitCode(err)
+				log.Warnf("Daemon probe %s exited with code %d", pe.Path, exitCode)
+				probeResult = NewProbeResult(wigoUtils.StatusError, exitCode, fmt.Sprintf("Daemon probe exited with code %d", exitCode), "")
+			}
+			probeResult.Stderr = stderr.String()
+			return
+		}
+	}
+}
+
+// daemonLine is a line of a daemon probe output. The
+// content of oversized lines is discarded.
+type daemonLine struct {
+	data      []byte
+	oversized bool
+}
+
+// readLines send every line read from r to lines. Lines longer than
+// max bytes are discarded and sent as oversized so a single oversized
+// result does not prevent reading the next ones.
+func readLines(r io.Reader, max int, lines chan<- *daemonLine) error {
+	reader := bufio.NewReader(r)
+	line := new(daemonLine)
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !line.oversized {
+			if max > 0 && len(line.data)+len(chunk) > max {
+				line.data = nil
+				line.oversized = true
+			} else {
+				line.data = append(line.data, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if len(line.data) > 0 || line.oversized {
+			lines <- line
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = new(daemonLine)
+	}
+}
+
+// daemonResult parse a line of a daemon probe output,
+// nil is returned for empty lines
+func (pe *ProbeExecutor) daemonResult(line *daemonLine) (probeResult *ProbeResult) {
+	if line.oversized {
+		pe.updateStats()
+		log.Warnf("Daemon probe %s result exceeds %d bytes, discarded", pe.Path, pe.Settings.MaxStdoutSize)
+		return NewProbeResult(wigoUtils.StatusInvalidResult, -1, fmt.Sprintf("Probe result exceeds %d bytes", pe.Settings.MaxStdoutSize), "")
+	}
+	data := bytes.TrimSpace(line.data)
+	if len(data) == 0 {
+		return nil
+	}
+	pe.updateStats()
+
+	probeResult, err := NewProbeResultFromJSON(data)
+	if err != nil {
+		log.Warnf("Daemon probe %s unable to deserialize probe result : %s", pe.Path, err)
+		probeResult = NewProbeResult(wigoUtils.StatusInvalidResult, -1, fmt.Sprintf("Unable to deserialize probe result : %s", err), "")
+		probeResult.Stdout = string(data)
+		return
+	}
+	probeResult.Clean()
+	pe.saveState(probeResult)
+	return
+}
@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"github.com/root-gg/wigo/wigo/utils"
+	"testing"
+	"time"
+)
+
+func waitDaemonResult(t *testing.T, pe *ProbeExecutor) (result *ProbeResult) {
+	select {
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timeout waiting for daemon probe result")
+	case result = <-pe.Results:
+	}
+	return
+}
+
+func TestRunDaemonProbe(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("daemon.sh", `i=0
+while true; do
+	i=$((i+1))
+	echo "{\"status\":100,\"message\":\"$i\"}"
+	echo
+	sleep 0.1
+done`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+
+	pe := NewProbeExecutor(path, 60)
+	pe.Settings.Daemon = true
+	go pe.Run()
+
+	for _, expected := range []string{"1", "2", "3"} {
+		result := waitDaemonResult(t, pe)
+		if result.Message != expected || result.Name != "daemon" {
+			t.Fatalf("Invalid daemon probe result %s, expected %s", result.Message, expected)
+		}
+	}
+
+	pe.Shutdown()
+	for range pe.Results {
+	}
+	if stats := pe.Stats(); stats.Executions < 3 {
+		t.Fatalf("Invalid executions count %d", stats.Executions)
+	}
+}
+
+func TestRunDaemonProbeRestart(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	daemonMinBackoff = 10 * time.Millisecond
+	defer func() { daemonMinBackoff = time.Second }()
+
+	path, err := setupShellProbe("daemon.sh", `echo "{\"status\":200,\"message\":\"started\"}"
+echo "invalid"
+exit 3`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+
+	pe := NewProbeExecutor(path, 60)
+	pe.Settings.Daemon = true
+	go pe.Run()
+	defer pe.Shutdown()
+
+	expected := []int{utils.StatusWarn, utils.StatusInvalidResult, utils.StatusError, utils.StatusWarn}
+	for _, status := range expected {
+		result := waitDaemonResult(t, pe)
+		if result.Status != status {
+			t.Fatalf("Invalid daemon probe status %d, expected %d : %s", result.Status, status, result.Message)
+		}
+		if status == utils.StatusError && result.ExitCode != 3 {
+			t.Fatalf("Invalid daemon probe exit code %d, expected %d", result.ExitCode, 3)
+		}
+	}
+}
+
+func TestRunDaemonProbeOversizedResult(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("daemon.sh", `printf '{"status":100,"message":"%05000d"}\n' 0
+echo "{\"status\":100,\"message\":\"next\"}"
+sleep 10`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+
+	pe := NewProbeExecutor(path, 60)
+	pe.Settings.Daemon = true
+	pe.Settings.MaxStdoutSize = 1024
+	go pe.Run()
+	defer pe.Shutdown()
+
+	if result := waitDaemonResult(t, pe); result.Status != utils.StatusInvalidResult {
+		t.Fatalf("Invalid daemon probe status %d, expected %d", result.Status, utils.StatusInvalidResult)
+	}
+	if result := waitDaemonResult(t, pe); result.Status != utils.StatusOk || result.Message != "next" {
+		t.Fatalf("Invalid daemon probe result %d %s, expected %d next", result.Status, result.Message, utils.StatusOk)
+	}
+}
+
+func TestRunDaemonProbeStale(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("daemon.sh", `echo "{\"status\":100,\"message\":\"started\"}"
+sleep 10`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+
+	pe := NewProbeExecutor(path, 60)
+	pe.Settings.Daemon = true
+	pe.Settings.StaleWindow = 1
+	go pe.Run()
+
+	if result := waitDaemonResult(t, pe); result.Status != utils.StatusOk {
+		t.Fatalf("Invalid daemon probe status %d, expected %d", result.Status, utils.StatusOk)
+	}
+	result := waitDaemonResult(t, pe)
+	if result.Status != utils.StatusStale || result.Reason != "stale" {
+		t.Fatalf("Invalid daemon probe status %d, expected %d", result.Status, utils.StatusStale)
+	}
+
+	// The probe and its children are killed on shutdown
+	start := time.Now()
+	pe.Shutdown()
+	for range pe.Results {
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("Daemon probe not killed on shutdown")
+	}
+}
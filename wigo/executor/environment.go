@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"github.com/root-gg/wigo/wigo/config"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Default PATH of probes running with a clean environment
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// ProbeEnvironment holds the agent wide values
+// exported to every probe
+type ProbeEnvironment struct {
+	ConfigRoot string
+	LibRoot    string
+	StateRoot  string
+	Hostname   string
+	Group      string
+	Uuid       string
+}
+
+var probeEnvironment *ProbeEnvironment
+var probeEnvironmentLock sync.RWMutex
+
+// SetEnvironment set the agent wide probe environment. It
+// may be replaced while probes are running, not modified.
+func SetEnvironment(env *ProbeEnvironment) {
+	probeEnvironmentLock.Lock()
+	defer probeEnvironmentLock.Unlock()
+
+	probeEnvironment = env
+}
+
+// GetEnvironment return the agent wide probe environment.
+// If none has been set it is derived from the configuration.
+func GetEnvironment() *ProbeEnvironment {
+	probeEnvironmentLock.RLock()
+	env := probeEnvironment
+	probeEnvironmentLock.RUnlock()
+	if env != nil {
+		return env
+	}
+
+	c := config.GetConfig()
+	if c == nil {
+		c = config.NewConfig()
+	}
+
+	env = new(ProbeEnvironment)
+	env.ConfigRoot = c.Global.ProbesConfigDirectory
+	env.LibRoot = c.Global.ProbesLibDirectory
+	env.StateRoot = c.Global.ProbesStateDirectory
+	env.Hostname = c.Global.Hostname
+	env.Group = c.Global.Group
+	return env
+}
+
+// environment build the environment of the probe process. Probe
+// settings are applied last so they can override anything.
+func (pe *ProbeExecutor) environment() (env []string) {
+	if pe.Settings.CleanEnv {
+		env = []string{"PATH=" + defaultPath}
+	} else {
+		env = os.Environ()
+	}
+
+	// Probes are given their whole interval to complete
+	agent := GetEnvironment()
+	env = append(env,
+		"WIGO_PROBE_CONFIG_ROOT="+agent.ConfigRoot,
+		"WIGO_PROBE_LIB_ROOT="+agent.LibRoot,
+		"WIGO_PROBE_NAME="+probeName(pe.Path),
+		"WIGO_PROBE_INTERVAL="+strconv.Itoa(pe.Timeout),
+		"WIGO_PROBE_TIMEOUT="+strconv.Itoa(pe.Timeout),
+		"WIGO_HOSTNAME="+agent.Hostname,
+		"WIGO_GROUP="+agent.Group,
+		"WIGO_UUID="+agent.Uuid,
+	)
+
+	// Probes return their updated persistent data in their result
+	if probeStore != nil {
+		env = append(env, "WIGO_PROBE_PERSIST_FILE="+pe.statePath())
+	}
+
+	// Sort keys to keep the environment stable between runs
+	keys := make([]string, 0, len(pe.Settings.Env))
+	for key := range pe.Settings.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+pe.Settings.Env[key])
+	}
+
+	// exec.Cmd only keeps the last value of duplicated keys
+	return
+}
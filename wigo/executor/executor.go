@@ -3,8 +3,11 @@ package executor
 import (
 	"bytes"
 	"fmt"
+	"io"
 	log "github.com/Sirupsen/logrus"
 	"github.com/root-gg/utils"
+	"github.com/root-gg/wigo/wigo/config"
+	wigoUtils "github.com/root-gg/wigo/wigo/utils"
 	"os"
 	"os/exec"
 	"path"
@@ -13,133 +16,224 @@ import (
 	"sync"
 )
 
+// Extra seconds given to a probe result before it is considered stale
+// so scheduling jitter never raises a stale probe
+const staleGrace = 10
+
 // ProbeExecutor manage running probes and
 // getting probe results from them
 type ProbeExecutor struct {
-	Path    string
-	Timeout int
-	Enabled bool
-	Results chan *ProbeResult
+	Path     string
+	Name     string
+	Timeout  int
+	Enabled  bool
+	Results  chan *ProbeResult
+	Settings *config.ProbeSettings
+	Native   NativeProbe
+
+	// Tags added to every result ( eg : the team of the probe )
+	Tags map[string]string
 
-	lock	sync.Mutex
+	// Name of the results of the probe, prefixed by the team of the
+	// probe if any ( eg : infra/check_disk ) so probes with the same
+	// name in different teams don't overwrite each other's results
+	Key string
+
+	stats    ProbeExecutorStats
+	previous *ProbeResult
+	config   []byte
+	running  chan *ProbeResult
+	wake     chan struct{}
+	stop     chan struct{}
+	lock     sync.Mutex
+}
+
+// ProbeExecutorStats holds counters about probe executions
+type ProbeExecutorStats struct {
+	Executions      int `json:"executions"`
+	OutputTruncated int `json:"outputTruncated"`
 }
 
 // NewProbeExecutor create a new ProbeExecutor instance
 func NewProbeExecutor(path string, timeout int) (pe *ProbeExecutor) {
 	pe = new(ProbeExecutor)
 	pe.Path = path
+	pe.Name = probeName(path)
+	pe.Key = pe.Name
 	pe.Timeout = timeout
 	pe.Enabled = true
 	pe.Results = make(chan *ProbeResult)
+	pe.wake = make(chan struct{}, 1)
+	pe.stop = make(chan struct{})
+	pe.Settings = config.NewProbeSettings()
+	if config.GetConfig() != nil {
+		pe.Settings = config.GetConfig().Probes.Settings(path)
+	}
 	return pe
 }
 
+// Stats return a copy of the probe execution counters
+func (pe *ProbeExecutor) Stats() ProbeExecutorStats {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	return pe.stats
+}
+
 // Run a probe every delay in seconds and publish results
-// to the resultChannel
+// to the resultChannel. The result channel is closed when the
+// executor stops, either because it has been shut down or because
+// the probe has been removed from the file system. Daemon probes
+// are kept running instead of being run every delay. The executor
+// is paused while the probe is disabled by its config.
 func (pe *ProbeExecutor) Run() (err error) {
+	defer close(pe.Results)
+	if pe.Settings.Daemon && pe.Native == nil {
+		pe.runDaemon()
+		return
+	}
+
+	paused := false
 	for {
-		timer := utils.NewSplitTime(pe.Path)
-		timer.Start()
-		result := pe.Execute()
-		if pe.Enabled {
-			pe.Results <- result
-			if result.Status == 999 {
+		if pe.Native == nil {
+			if _, err := os.Lstat(pe.Path); os.IsNotExist(err) {
+				log.Infof("Probe %s has been removed", pe.Path)
+				pe.deleteState()
 				pe.Shutdown()
 				break
 			}
+		}
+
+		timer := utils.NewSplitTime(pe.Name)
+		timer.Start()
+		var result *ProbeResult
+		if pe.disabled() {
+			if !paused {
+				result = pe.disabledResult()
+			}
+			paused = true
 		} else {
-			break
+			result = pe.Execute()
+			paused = false
+		}
+		if result != nil {
+			select {
+			case <-pe.stop:
+				return
+			case pe.Results <- result:
+			}
 		}
 		timer.Stop()
 		wait := pe.Timeout - int(timer.Elapsed().Seconds())
 		if wait > 0 {
-			time.Sleep(time.Duration(wait) * time.Second)
+			select {
+			case <-pe.stop:
+				return
+			case <-pe.wake:
+			case <-time.After(time.Duration(wait) * time.Second):
+			}
 		}
 	}
 	return
 }
 
+// tag add the executor tags to a result
+func (pe *ProbeExecutor) tag(result *ProbeResult) {
+	if len(pe.Tags) == 0 {
+		return
+	}
+	if result.Tags == nil {
+		result.Tags = make(map[string]string)
+	}
+	for key, value := range pe.Tags {
+		result.Tags[key] = value
+	}
+}
+
 // Execute the probe and always return a ProbeResult. If an error
 // occurred the ProbeResult is handcrafted with the cause.
 func (pe *ProbeExecutor) Execute() (probeResult *ProbeResult) {
-	log.Debugf("Executing probe %s", pe.Path)
+	log.Debugf("Executing probe %s", pe.Name)
+	defer func() {
+		probeResult.Path = pe.Path
+		probeResult.Name = pe.Key
+		pe.tag(probeResult)
 
-	// Stat prob
-	fileInfo, err := os.Stat(pe.Path)
-	if err != nil {
-		log.Warnf("Failed to stat probe %s : %s", pe.Path, err)
-		probeResult = NewProbeResult(999, -1, fmt.Sprintf("Failed to stat probe : %s", err), "")
-		return
-	}
+		// The next result is expected within the probe interval and timeout
+		probeResult.Ttl = 2*pe.Timeout + staleGrace
 
-	// Check if probe executable
-	if m := fileInfo.Mode(); m&0111 == 0 {
-		log.Warnf("Probe %s is not executable : %s", pe.Path, m.Perm().String())
-		probeResult = NewProbeResult(998, -1, fmt.Sprintf("Probe is not executable : %s", m.Perm().String()), "")
-		return
-	}
+		pe.lock.Lock()
+		pe.previous = probeResult
+		pe.lock.Unlock()
+	}()
 
-	// Create command
-	cmd := exec.Command(pe.Path)
-	cmd.Dir = path.Dir(pe.Path)
+	if pe.Native != nil {
+		return pe.executeNative()
+	}
 
-	// Capture stdout
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
+	// Capture outputs
+	stdout := NewOutputBuffer(pe.Settings.MaxStdoutSize)
+	stderr := NewOutputBuffer(pe.Settings.MaxStderrSize)
 
-	// Capture stderr
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	cmd, probeResult := pe.start(stdout, stderr)
+	if probeResult != nil {
+		return
+	}
 
-	// Execute probe
+	// Wait for probe to exit
 	done := make(chan error)
 	go func() {
-		done <- cmd.Run()
+		done <- cmd.Wait()
 	}()
 
+	var err error
 	select {
 	case <-time.After(time.Duration(pe.Timeout) * time.Second):
 		// Handle timeout
 		log.Warnf("Probe %s timed out after %ds", pe.Path, pe.Timeout)
-		cmd.Process.Kill()
-		if err != nil {
+		if err = cmd.Process.Kill(); err != nil {
 			log.Warnf("Unable to kill probe %s : %s", pe.Path, err)
 		} else {
 			log.Warnf("Probe %s with pid %d killed", pe.Path, cmd.Process.Pid)
 		}
-		probeResult = NewProbeResult(997, -1, fmt.Sprintf("Probe timed out after %ds", pe.Timeout), "")
+		probeResult = NewProbeResult(wigoUtils.StatusTimeout, -1, fmt.Sprintf("Probe timed out after %ds", pe.Timeout), "")
+		pe.updateStats()
 	case err = <-done:
+		pe.updateStats(stdout, stderr)
+
 		// Check if probe has been executed successfully
-		if err == nil {
+		if err == nil && pe.Settings.Mode != ModeNagios {
 			// Get result from probe output
 			probeResult, err = NewProbeResultFromJSON(stdout.Bytes())
 			if err != nil {
 				log.Warnf("Probe %s unable to deserialize probe result : %s", pe.Path, err)
-				probeResult = NewProbeResult(996, -1, fmt.Sprintf("Unable to deserialize probe result : %s", err), "")
-				probeResult.Stdout = string(stdout.Bytes())
-				probeResult.Stderr = string(stderr.Bytes())
+				probeResult = NewProbeResult(wigoUtils.StatusInvalidResult, -1, fmt.Sprintf("Unable to deserialize probe result : %s", err), "")
+				probeResult.Stdout = stdout.String()
+				probeResult.Stderr = stderr.String()
 				return
 			}
 			probeResult.Clean()
-		} else {
-			// Get exit code
-			exitCode := 1
-			if exiterr, ok := err.(*exec.ExitError); ok {
-				// The program has exited with an exit code != 0
-
-				// This works on both Unix and Windows. Although package
-				// syscall is generally platform dependent, WaitStatus is
-				// defined for both Unix and Windows and in both cases has
-				// an ExitStatus() method with the same signature.
-				if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-					exitCode = status.ExitStatus()
-				}
+			pe.saveState(probeResult)
+			if pe.Settings.KeepStderr {
+				probeResult.Stderr = stderr.String()
 			}
-
+		} else if status, message := pe.limitViolation(cmd.ProcessState, stderr.Bytes()); err != nil && status != 0 {
+			log.Warnf("Probe %s killed : %s", pe.Path, message)
+			probeResult = NewProbeResult(status, -1, message, "")
+			probeResult.Stdout = stdout.String()
+			probeResult.Stderr = stderr.String()
+		} else if pe.Settings.Mode == ModeNagios {
+			// Nagios plugins report their status with the exit code
+			probeResult = NewProbeResultFromNagios(exitCode(err), stdout.Bytes())
+			if probeResult.Status != wigoUtils.StatusOk || pe.Settings.KeepStderr {
+				probeResult.Stderr = stderr.String()
+			}
+		} else {
+			exitCode := exitCode(err)
 			log.Warnf("Probe %s exit code %d", pe.Path, exitCode)
-			probeResult = NewProbeResult(500, exitCode, fmt.Sprintf("Exit code %d", exitCode), "")
-			probeResult.Stdout = string(stdout.Bytes())
-			probeResult.Stderr = string(stderr.Bytes())
+			probeResult = NewProbeResult(wigoUtils.StatusError, exitCode, fmt.Sprintf("Exit code %d", exitCode), "")
+			probeResult.Stdout = stdout.String()
+			probeResult.Stderr = stderr.String()
 
 			return
 		}
@@ -148,8 +242,126 @@ func (pe *ProbeExecutor) Execute() (probeResult *ProbeResult) {
 	return
 }
 
+// start the probe process with its outputs redirected to stdout
+// and stderr. If the probe can't be started a ProbeResult is
+// handcrafted with the cause.
+func (pe *ProbeExecutor) start(stdout io.Writer, stderr io.Writer) (cmd *exec.Cmd, probeResult *ProbeResult) {
+	// Stat prob
+	fileInfo, err := os.Stat(pe.Path)
+	if target, lerr := os.Readlink(pe.Path); err != nil && lerr == nil {
+		log.Warnf("Probe %s is a dangling symlink to %s", pe.Path, target)
+		probeResult = NewProbeResult(wigoUtils.StatusDanglingLink, -1, fmt.Sprintf("Probe is a dangling symlink to %s", target), "")
+		return
+	}
+	if err != nil {
+		log.Warnf("Failed to stat probe %s : %s", pe.Path, err)
+		probeResult = NewProbeResult(wigoUtils.StatusStatFailed, -1, fmt.Sprintf("Failed to stat probe : %s", err), "")
+		return
+	}
+
+	// Check if probe executable
+	if m := fileInfo.Mode(); m&0111 == 0 {
+		log.Warnf("Probe %s is not executable : %s", pe.Path, m.Perm().String())
+		probeResult = NewProbeResult(wigoUtils.StatusNotExecutable, -1, fmt.Sprintf("Probe is not executable : %s", m.Perm().String()), "")
+		return
+	}
+
+	// Create command
+	cmd = exec.Command(pe.Path, pe.Settings.Args...)
+	cmd.Dir = path.Dir(pe.Path)
+	cmd.Env = pe.environment()
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// Run probe with its resource limits
+	pe.wrap(cmd)
+
+	// Run probe as the configured user and group
+	if cmd.SysProcAttr, err = pe.sysProcAttr(); err != nil {
+		log.Warnf("Unable to run probe %s as %s:%s : %s", pe.Path, pe.Settings.User, pe.Settings.Group, err)
+		probeResult = NewProbeResult(wigoUtils.StatusCannotRun, -1, fmt.Sprintf("Unable to run probe as %s:%s : %s", pe.Settings.User, pe.Settings.Group, err), "")
+		return
+	}
+
+	// Give the probe its JSON envelope on stdin
+	if pe.Settings.Input == InputJson {
+		input, err := pe.input()
+		if err != nil {
+			log.Warnf("Unable to build probe %s input : %s", pe.Path, err)
+			probeResult = NewProbeResult(wigoUtils.StatusCannotRun, -1, fmt.Sprintf("Unable to build probe input : %s", err), "")
+			return
+		}
+		cmd.Stdin = bytes.NewReader(input)
+	}
+
+	// Give the probe the data it persisted during its previous run
+	if err = pe.writeState(cmd.SysProcAttr); err != nil {
+		log.Warnf("Unable to write probe %s state : %s", pe.Path, err)
+		probeResult = NewProbeResult(wigoUtils.StatusCannotRun, -1, fmt.Sprintf("Unable to write probe state : %s", err), "")
+		return
+	}
+
+	// Start probe
+	if err = cmd.Start(); err != nil {
+		log.Warnf("Unable to start probe %s : %s", pe.Path, err)
+		if cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+			probeResult = NewProbeResult(wigoUtils.StatusCannotRun, -1, fmt.Sprintf("Unable to start probe as %s:%s : %s", pe.Settings.User, pe.Settings.Group, err), "")
+		} else {
+			probeResult = NewProbeResult(wigoUtils.StatusError, 1, fmt.Sprintf("Unable to start probe : %s", err), "")
+		}
+		return
+	}
+
+	return
+}
+
+// exitCode return the exit code of a probe from its
+// execution error
+func exitCode(err error) (exitCode int) {
+	if err == nil {
+		return 0
+	}
+
+	exitCode = 1
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		// The program has exited with an exit code != 0
+
+		// This works on both Unix and Windows. Although package
+		// syscall is generally platform dependent, WaitStatus is
+		// defined for both Unix and Windows and in both cases has
+		// an ExitStatus() method with the same signature.
+		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			exitCode = status.ExitStatus()
+		}
+	}
+	return
+}
+
+// updateStats account a probe execution and the truncation
+// of its outputs. Outputs must not be written to anymore.
+func (pe *ProbeExecutor) updateStats(outputs ...*OutputBuffer) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	pe.stats.Executions++
+	for _, output := range outputs {
+		if output.Truncated() {
+			log.Warnf("Probe %s output truncated, %d bytes discarded", pe.Path, output.Discarded())
+			pe.stats.OutputTruncated++
+			break
+		}
+	}
+}
+
 // Shutdown disable the probe to prevent any new execution
 func (pe *ProbeExecutor) Shutdown() (err error) {
-	pe.Enabled = false
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	if pe.Enabled {
+		pe.Enabled = false
+		close(pe.stop)
+	}
 	return
 }
@@ -4,13 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/utils"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
+const tmpProbeDirectory = "/tmp/wigo_probe_test"
 const dummyProbePath = "../../probes/dummy.pl"
 const dummyProbeTmpPath = "/tmp/wigo_probe_test/dummy.pl"
 const tmpProbeConfigDir = "/tmp/wigo_probe_config_test"
@@ -79,15 +83,30 @@ func setupProbeExecutorTest() (err error) {
 		err = fmt.Errorf("Unable to copy dummy probe from %s to %s : %s", dummyProbePath, dummyProbeTmpPath, err)
 		return
 	}
-	// Set config root
-	os.Setenv("WIGO_PROBE_CONFIG_ROOT", tmpProbeConfigDir)
 	// Set probe lib root
 	libRoot, err := filepath.Abs("../../lib")
 	if err != nil {
 		log.Errorf("Unable to get lib root : %s", err)
 		return
 	}
-	os.Setenv("WIGO_PROBE_LIB_ROOT", libRoot)
+	// Set probe environment
+	env := new(ProbeEnvironment)
+	env.ConfigRoot = tmpProbeConfigDir
+	env.LibRoot = libRoot
+	env.Hostname = "localhost"
+	env.Uuid = "713b75b7-c20e-45b5-bfaf-0728dd5f5ced"
+	SetEnvironment(env)
+	return
+}
+
+func setupShellProbe(name string, script string) (path string, err error) {
+	path = tmpProbeDirectory + "/" + name
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	_, err = io.WriteString(file, "#!/bin/sh\n"+script+"\n")
 	return
 }
 
@@ -141,8 +160,8 @@ func TestExecuteProbeWithTimeout(t *testing.T) {
 		t.Fatalf("Unable to setup dummy probe config : %s", err)
 	}
 	result := pe.Execute()
-	if result.Status != 997 {
-		t.Fatalf("Invalid status %d, expected %d", result.Status, 997)
+	if result.Status != utils.StatusTimeout {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusTimeout)
 	}
 	if result.ExitCode != -1 {
 		t.Fatalf("Invalid exit code %d, expected %d", result.ExitCode, -1)
@@ -177,11 +196,10 @@ func TestRun(t *testing.T) {
 		t.Fatalf("Unable to setup test : %s", err)
 	}
 	pe := NewProbeExecutor(dummyProbeTmpPath, 1)
-	results := make(chan *ProbeResult)
-	pe.Run(results)
+	go pe.Run()
 
 	for i := 0; i < 2; i++ {
-		result := <-results
+		result := <-pe.Results
 		if result.Status != 100 {
 			t.Fatalf("Invalid status %d, expected %d", result.Status, 100)
 		}
@@ -198,3 +216,412 @@ func TestRun(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestExecuteProbeWithTruncatedStdout(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("verbose.sh", "echo 0123456789abcdef; exit 1")
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 1)
+	pe.Settings.MaxStdoutSize = 10
+	result := pe.Execute()
+	if result.Status != 500 {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, 500)
+	}
+	expected := "0123456789\n[... truncated 7 bytes]"
+	if result.Stdout != expected {
+		t.Fatalf("Invalid stdout output %q, expected %q", result.Stdout, expected)
+	}
+	if stats := pe.Stats(); stats.OutputTruncated != 1 {
+		t.Fatalf("Invalid output truncated count %d, expected %d", stats.OutputTruncated, 1)
+	}
+}
+
+func TestExecuteProbeKeepStderr(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("warning.sh", `echo '{"status":100,"message":"ok"}'; echo -n warning >&2`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 1)
+	result := pe.Execute()
+	if result.Stderr != "" {
+		t.Fatalf("Invalid stderr output %q, expected %q", result.Stderr, "")
+	}
+
+	pe.Settings.KeepStderr = true
+	pe.Settings.MaxStderrSize = 4
+	result = pe.Execute()
+	if result.Status != 100 {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, 100)
+	}
+	expected := "warn\n[... truncated 3 bytes]"
+	if result.Stderr != expected {
+		t.Fatalf("Invalid stderr output %q, expected %q", result.Stderr, expected)
+	}
+	if stats := pe.Stats(); stats.Executions != 2 {
+		t.Fatalf("Invalid execution count %d, expected %d", stats.Executions, 2)
+	}
+}
+
+func TestExecuteProbeWithCpuLimit(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("busy.sh", "while :; do :; done")
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 5)
+	pe.Settings.MaxCpuTime = 1
+	result := pe.Execute()
+	if result.Status != utils.StatusCpuLimit {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCpuLimit)
+	}
+}
+
+func TestExecuteProbeWithNice(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("nice.sh", `echo "{\"status\":100,\"message\":\"$(nice) $(ulimit -n)\"}"`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 1)
+	pe.Settings.Nice = 10
+	pe.Settings.MaxOpenFiles = 64
+	result := pe.Execute()
+	if result.Status != 100 {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, 100)
+	}
+	if result.Message != "10 64" {
+		t.Fatalf("Invalid niceness and open files limit %s, expected %s", result.Message, "10 64")
+	}
+}
+
+func TestExecuteProbeWithCrash(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("crash.sh", "kill -SEGV $$")
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 1)
+	pe.Settings.MaxMemory = 1 << 30
+	result := pe.Execute()
+	if result.Status != utils.StatusError {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusError)
+	}
+}
+
+func TestExecuteProbeWithMemoryLimit(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("memory.sh", `perl -e 'my $data = "x" x (512 * 1024 * 1024)'`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 5)
+	pe.Settings.MaxMemory = 256 << 20
+	result := pe.Execute()
+	if result.Status != utils.StatusMemoryLimit {
+		t.Fatalf("Invalid status %d, expected %d : %s", result.Status, utils.StatusMemoryLimit, result.Message)
+	}
+}
+
+func TestExecuteProbeWithUnknownUser(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	pe := NewProbeExecutor(dummyProbeTmpPath, 1)
+	pe.Settings.User = "wigo_unknown_user"
+	result := pe.Execute()
+	if result.Status != utils.StatusCannotRun {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCannotRun)
+	}
+}
+
+func TestExecuteProbeAsUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Running probes as another user requires root privileges")
+	}
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("whoami.sh", `echo "{\"status\":100,\"message\":\"$(id -un)\"}"`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 1)
+	pe.Settings.User = "nobody"
+	result := pe.Execute()
+	if result.Status != 100 {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, 100)
+	}
+	if result.Message != "nobody" {
+		t.Fatalf("Invalid user %s, expected %s", result.Message, "nobody")
+	}
+}
+
+func TestExecuteProbeEnvironment(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	os.Setenv("WIGO_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("WIGO_TEST_INHERITED")
+	path, err := setupShellProbe("env.sh", `echo "{\"status\":100,\"message\":\"$WIGO_PROBE_NAME $WIGO_PROBE_INTERVAL $WIGO_HOSTNAME $WIGO_UUID $FOO $WIGO_TEST_INHERITED $*\"}"`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 1)
+	pe.Settings.Args = []string{"foo", "bar"}
+	pe.Settings.Env = map[string]string{"FOO": "bar"}
+	result := pe.Execute()
+	expected := "env 1 localhost 713b75b7-c20e-45b5-bfaf-0728dd5f5ced bar inherited foo bar"
+	if result.Message != expected {
+		t.Fatalf("Invalid message %s, expected %s", result.Message, expected)
+	}
+
+	pe.Settings.CleanEnv = true
+	result = pe.Execute()
+	expected = "env 1 localhost 713b75b7-c20e-45b5-bfaf-0728dd5f5ced bar  foo bar"
+	if result.Message != expected {
+		t.Fatalf("Invalid message %s, expected %s", result.Message, expected)
+	}
+}
+
+func TestRunRemovedProbe(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	pe := NewProbeExecutor(dummyProbeTmpPath, 1)
+	go pe.Run()
+
+	<-pe.Results
+	if err := os.Remove(dummyProbeTmpPath); err != nil {
+		t.Fatalf("Unable to remove dummy probe : %s", err)
+	}
+
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for result channel to be closed")
+	case _, ok := <-pe.Results:
+		if ok {
+			t.Fatal("Result channel should be closed once the probe is removed")
+		}
+	}
+}
+
+func TestRunDanglingSymlinkProbe(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	linkPath := tmpProbeDirectory + "/link.pl"
+	if err := os.Symlink(tmpProbeDirectory+"/missing.pl", linkPath); err != nil {
+		t.Fatalf("Unable to create dummy probe symlink : %s", err)
+	}
+	pe := NewProbeExecutor(linkPath, 1)
+	go pe.Run()
+	defer pe.Shutdown()
+
+	// Dangling symlinks are reported instead of being removed
+	for i := 0; i < 2; i++ {
+		select {
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timeout waiting for probe result")
+		case result, ok := <-pe.Results:
+			if !ok {
+				t.Fatal("Result channel closed for a dangling symlink")
+			}
+			if result.Status != utils.StatusDanglingLink {
+				t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusDanglingLink)
+			}
+		}
+	}
+}
+
+func TestExecuteNagiosPlugin(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("check_dummy", "echo 'DUMMY CRITICAL - dummy | dummy=26s;10;20'; exit 2")
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	pe := NewProbeExecutor(path, 1)
+	pe.Settings.Mode = ModeNagios
+	result := pe.Execute()
+	if result.Status != utils.StatusCrit {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCrit)
+	}
+	if result.ExitCode != 2 {
+		t.Fatalf("Invalid exit code %d, expected %d", result.ExitCode, 2)
+	}
+	if result.Message != "DUMMY CRITICAL - dummy" {
+		t.Fatalf("Invalid message %s, expected %s", result.Message, "DUMMY CRITICAL - dummy")
+	}
+	if len(result.Metrics) != 1 || result.Metrics[0].Value != 26 {
+		t.Fatal("Invalid probe metrics")
+	}
+	if result.Name != "check_dummy" {
+		t.Fatalf("Invalid probe name %s, expected %s", result.Name, "check_dummy")
+	}
+}
+
+type mapStore map[string][]byte
+
+func (s mapStore) Get(key string) ([]byte, error)     { return s[key], nil }
+func (s mapStore) Set(key string, value []byte) error { s[key] = value; return nil }
+func (s mapStore) Delete(key string) error            { delete(s, key); return nil }
+
+func TestPersist(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	store := make(mapStore)
+	SetStore(store)
+	defer SetStore(nil)
+	GetEnvironment().StateRoot = tmpProbeConfigDir + "/state"
+
+	path, err := setupShellProbe("persist.sh", `n=$(cat "$WIGO_PROBE_PERSIST_FILE")
+n=$((${n:-0}+1))
+echo "{\"status\":100,\"message\":\"run $n\",\"persist\":$n}"`)
+	if err != nil {
+		t.Fatalf("Unable to setup probe : %s", err)
+	}
+
+	pe := NewProbeExecutor(path, 1)
+	for i := 1; i <= 2; i++ {
+		result := pe.Execute()
+		if result.Message != fmt.Sprintf("run %d", i) {
+			t.Fatalf("Invalid message %s, expected run %d", result.Message, i)
+		}
+		if result.Persist != nil {
+			t.Fatal("Persistent data should be removed from the result")
+		}
+	}
+	if value := string(store["probe:"+path]); value != "2" {
+		t.Fatalf("Invalid persistent data %s, expected %s", value, "2")
+	}
+	if info, err := os.Stat(pe.statePath()); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Invalid state file : %v", err)
+	}
+
+	// Probes with the same name do not collide
+	other := NewProbeExecutor(tmpProbeDirectory+"/other/persist.sh", 1)
+	if other.statePath() == pe.statePath() {
+		t.Fatalf("State file %s collides", pe.statePath())
+	}
+}
+
+func TestExecuteProbeJsonInput(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("input.sh", `echo "{\"status\":100,\"message\":\"ok\",\"details\":$(cat)}"`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	config := "{ \"foo\" : \"bar\" } # comment"
+	if err = ioutil.WriteFile(tmpProbeConfigDir+"/input.conf", []byte(config), 0644); err != nil {
+		t.Fatalf("Unable to setup probe config : %s", err)
+	}
+
+	pe := NewProbeExecutor(path, 1)
+	pe.Settings.Input = InputJson
+	result := pe.Execute()
+	if result.Status != 100 {
+		t.Fatalf("Invalid status %d, expected %d : %s", result.Status, 100, result.Message)
+	}
+	input := result.Details.(map[string]interface{})
+	if input["name"] != "input" || input["previous"] != nil {
+		t.Fatalf("Invalid probe input %v", input)
+	}
+	if input["config"].(map[string]interface{})["foo"] != "bar" {
+		t.Fatalf("Invalid probe input config %v", input["config"])
+	}
+	if input["host"].(map[string]interface{})["hostname"] != "localhost" {
+		t.Fatalf("Invalid probe input host %v", input["host"])
+	}
+	if deadline := int64(input["deadline"].(float64)); deadline < time.Now().Unix() {
+		t.Fatalf("Invalid probe input deadline %d", deadline)
+	}
+
+	// Second run gets the previous result
+	result = pe.Execute()
+	input = result.Details.(map[string]interface{})
+	if previous, ok := input["previous"].(map[string]interface{}); !ok || previous["message"] != "ok" {
+		t.Fatalf("Invalid probe input previous result %v", input["previous"])
+	}
+
+	// Invalid configs are not applied
+	if err = ioutil.WriteFile(tmpProbeConfigDir+"/input.conf", []byte("{"), 0644); err != nil {
+		t.Fatalf("Unable to setup probe config : %s", err)
+	}
+	result = pe.Execute()
+	input = result.Details.(map[string]interface{})
+	if input["config"].(map[string]interface{})["foo"] != "bar" {
+		t.Fatalf("Invalid probe input config %v", input["config"])
+	}
+
+	// Without any valid config the probe can't run
+	pe = NewProbeExecutor(path, 1)
+	pe.Settings.Input = InputJson
+	if result = pe.Execute(); result.Status != utils.StatusCannotRun {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCannotRun)
+	}
+}
+
+func TestRunDisabledProbe(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path, err := setupShellProbe("disabled.sh", `echo '{"status":200,"message":"running"}'`)
+	if err != nil {
+		t.Fatalf("Unable to setup shell probe : %s", err)
+	}
+	if err = ioutil.WriteFile(tmpProbeConfigDir+"/disabled.conf", []byte(`{"enabled":false}`), 0644); err != nil {
+		t.Fatalf("Unable to setup probe config : %s", err)
+	}
+
+	pe := NewProbeExecutor(path, 60)
+	go pe.Run()
+	defer pe.Shutdown()
+
+	result := <-pe.Results
+	if result.Status != utils.StatusOk || result.Reason != "disabled" {
+		t.Fatalf("Invalid disabled result %d %s", result.Status, result.Reason)
+	}
+
+	// Invalid configs are not applied
+	if err = ioutil.WriteFile(tmpProbeConfigDir+"/disabled.conf", []byte(`{"enabled":`), 0644); err != nil {
+		t.Fatalf("Unable to setup probe config : %s", err)
+	}
+	if err = pe.Reload(); err == nil {
+		t.Fatal("No error while reloading an invalid config")
+	}
+
+	// Enable the probe, it runs right away
+	if err = ioutil.WriteFile(tmpProbeConfigDir+"/disabled.conf", []byte(`{"enabled":true}`), 0644); err != nil {
+		t.Fatalf("Unable to setup probe config : %s", err)
+	}
+	if err = pe.Reload(); err != nil {
+		t.Fatalf("Unable to reload probe config : %s", err)
+	}
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for probe result")
+	case result = <-pe.Results:
+		if result.Status != 200 {
+			t.Fatalf("Invalid status %d, expected %d", result.Status, 200)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+// Probe input modes
+const (
+	InputNone = "none"
+	InputJson = "json"
+)
+
+// ProbeInput is the JSON envelope written to the stdin of probes
+// using the json input mode. It gives probes everything they need
+// without reading files or using a client library.
+type ProbeInput struct {
+	Name     string          `json:"name"`
+	Path     string          `json:"path"`
+	Args     []string        `json:"args"`
+	Config   json.RawMessage `json:"config"`
+	Previous *ProbeResult    `json:"previous"`
+	Persist  json.RawMessage `json:"persist"`
+	Host     ProbeInputHost  `json:"host"`
+	Interval int             `json:"interval"`
+	Deadline int64           `json:"deadline"`
+}
+
+// ProbeInputHost is the identity of the host running the probe
+type ProbeInputHost struct {
+	Hostname string `json:"hostname"`
+	Group    string `json:"group"`
+	Uuid     string `json:"uuid"`
+}
+
+// input build the JSON envelope of the probe. The config is null if the
+// probe has no configuration file, the previous result is null on the
+// first run.
+func (pe *ProbeExecutor) input() (input []byte, err error) {
+	agent := GetEnvironment()
+
+	pi := new(ProbeInput)
+	pi.Name = pe.Name
+	pi.Path = pe.Path
+	pi.Args = pe.Settings.Args
+	if pi.Args == nil {
+		pi.Args = []string{}
+	}
+	pi.Host.Hostname = agent.Hostname
+	pi.Host.Group = agent.Group
+	pi.Host.Uuid = agent.Uuid
+	pi.Interval = pe.Timeout
+	pi.Deadline = time.Now().Add(time.Duration(pe.Timeout) * time.Second).Unix()
+
+	config, err := pe.loadConfig()
+	if err != nil {
+		if config == nil {
+			return nil, err
+		}
+		log.Warnf("Probe %s : %s, using the last valid config", pe.Name, err)
+	}
+	if len(bytes.TrimSpace(config)) > 0 {
+		pi.Config = config
+	}
+
+	if probeStore != nil {
+		persist, err := probeStore.Get(pe.persistKey())
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get persistent data : %s", err)
+		}
+		if len(persist) > 0 {
+			pi.Persist = persist
+		}
+	}
+
+	pe.lock.Lock()
+	pi.Previous = pe.previous
+	pe.lock.Unlock()
+
+	return json.Marshal(pi)
+}
@@ -0,0 +1,237 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/utils"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// RLIMIT_NPROC is not exported by the syscall package
+const rlimitNproc = 6
+
+// sysProcAttr return the process attributes needed to run
+// the probe as the configured user and group if any
+func (pe *ProbeExecutor) sysProcAttr() (attr *syscall.SysProcAttr, err error) {
+	// Daemon probes run in their own process group so
+	// they can be killed along with their children
+	if pe.Settings.Daemon {
+		attr = &syscall.SysProcAttr{Setpgid: true}
+	}
+
+	if pe.Settings.User == "" && pe.Settings.Group == "" {
+		return
+	}
+
+	credential := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	if pe.Settings.User != "" {
+		u, err := user.Lookup(pe.Settings.User)
+		if err != nil {
+			return nil, err
+		}
+		uid, _ := strconv.Atoi(u.Uid)
+		gid, _ := strconv.Atoi(u.Gid)
+		credential.Uid = uint32(uid)
+		credential.Gid = uint32(gid)
+	}
+
+	if pe.Settings.Group != "" {
+		g, err := user.LookupGroup(pe.Settings.Group)
+		if err != nil {
+			return nil, err
+		}
+		gid, _ := strconv.Atoi(g.Gid)
+		credential.Gid = uint32(gid)
+	}
+
+	if attr == nil {
+		attr = new(syscall.SysProcAttr)
+	}
+	attr.Credential = credential
+	return
+}
+
+// limits return the resource limits and niceness to apply to the probe
+// as an argument of the limits wrapper ( eg : "cpu=10,nice=5" ), empty
+// if the probe has none
+func (pe *ProbeExecutor) limits() string {
+	var limits []string
+	if pe.Settings.MaxCpuTime > 0 {
+		limits = append(limits, fmt.Sprintf("cpu=%d", pe.Settings.MaxCpuTime))
+	}
+	if pe.Settings.MaxMemory > 0 {
+		limits = append(limits, fmt.Sprintf("as=%d", pe.Settings.MaxMemory))
+	}
+	if pe.Settings.MaxOpenFiles > 0 {
+		limits = append(limits, fmt.Sprintf("nofile=%d", pe.Settings.MaxOpenFiles))
+	}
+	if pe.Settings.MaxProcesses > 0 {
+		limits = append(limits, fmt.Sprintf("nproc=%d", pe.Settings.MaxProcesses))
+	}
+	if pe.Settings.Nice != 0 {
+		limits = append(limits, fmt.Sprintf("nice=%d", pe.Settings.Nice))
+	}
+	return strings.Join(limits, ",")
+}
+
+// wrap the probe command in the limits wrapper if the probe has resource
+// limits. Go can't run code between fork and exec so wigo executes itself
+// to set the limits and then executes the probe, the probe and its children
+// never run without them.
+func (pe *ProbeExecutor) wrap(cmd *exec.Cmd) {
+	limits := pe.limits()
+	if limits == "" {
+		return
+	}
+	cmd.Args = append([]string{limitsWrapper, limits, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/proc/self/exe"
+}
+
+// Name wigo is executed with to run a probe with resource limits
+const limitsWrapper = "wigo-probe-limits"
+
+// Exit code of the limits wrapper if the limits can't be applied
+// or the probe can't be executed, along with an error on stderr
+const limitsExitCode = 126
+const limitsError = "wigo-probe-limits : "
+
+func init() {
+	if len(os.Args) > 2 && os.Args[0] == limitsWrapper {
+		runLimitsWrapper(os.Args[1], os.Args[2], os.Args[2:])
+	}
+}
+
+// runLimitsWrapper apply the resource limits to the current process and
+// execute the probe. It never returns.
+func runLimitsWrapper(limits string, path string, args []string) {
+	// Niceness is set per thread, the probe is executed from the same thread
+	runtime.LockOSThread()
+
+	err := setLimits(limits)
+	if err == nil {
+		err = syscall.Exec(path, args, os.Environ())
+	}
+	fmt.Fprintf(os.Stderr, "%s%s\n", limitsError, err)
+	os.Exit(limitsExitCode)
+}
+
+// setLimits set the resource limits and niceness of the current process.
+// The address space limit is set last as the wrapper may need to allocate.
+func setLimits(limits string) (err error) {
+	var memory uint64
+	for _, limit := range strings.Split(limits, ",") {
+		splits := strings.SplitN(limit, "=", 2)
+		if len(splits) != 2 {
+			return fmt.Errorf("invalid limit %s", limit)
+		}
+		value, err := strconv.Atoi(splits[1])
+		if err != nil {
+			return fmt.Errorf("invalid limit %s", limit)
+		}
+
+		switch splits[0] {
+		case "cpu":
+			// The soft limit sends SIGXCPU, the hard limit SIGKILL
+			err = setrlimit(syscall.RLIMIT_CPU, uint64(value), uint64(value)+1)
+		case "as":
+			memory = uint64(value)
+		case "nofile":
+			err = setrlimit(syscall.RLIMIT_NOFILE, uint64(value), uint64(value))
+		case "nproc":
+			err = setrlimit(rlimitNproc, uint64(value), uint64(value))
+		case "nice":
+			err = syscall.Setpriority(syscall.PRIO_PROCESS, 0, value)
+		default:
+			err = fmt.Errorf("unknown limit")
+		}
+		if err != nil {
+			return fmt.Errorf("unable to set %s : %s", limit, err)
+		}
+	}
+	if memory > 0 {
+		if err = setrlimit(syscall.RLIMIT_AS, memory, memory); err != nil {
+			return fmt.Errorf("unable to set as=%d : %s", memory, err)
+		}
+	}
+	return
+}
+
+// limitViolation check if a probe has been killed because it exceeded
+// one of its resource limits or if the limits wrapper failed to run it.
+// It returns a zero status if no violation has been detected.
+func (pe *ProbeExecutor) limitViolation(state *os.ProcessState, stderr []byte) (status int, message string) {
+	if state == nil {
+		return
+	}
+	waitStatus, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return
+	}
+
+	if pe.limits() != "" && waitStatus.ExitStatus() == limitsExitCode && bytes.HasPrefix(stderr, []byte(limitsError)) {
+		message = strings.TrimSpace(strings.TrimPrefix(string(stderr), limitsError))
+		return utils.StatusCannotRun, fmt.Sprintf("Unable to run probe with its resource limits : %s", message)
+	}
+
+	if pe.Settings.MaxCpuTime > 0 {
+		cpuTime := state.UserTime() + state.SystemTime()
+		if waitStatus.Signaled() && (waitStatus.Signal() == syscall.SIGXCPU || (waitStatus.Signal() == syscall.SIGKILL && int(cpuTime.Seconds()) >= pe.Settings.MaxCpuTime)) {
+			return utils.StatusCpuLimit, fmt.Sprintf("Probe exceeded its cpu time limit of %ds", pe.Settings.MaxCpuTime)
+		}
+	}
+
+	if pe.Settings.MaxMemory > 0 && outOfMemory(waitStatus, state, stderr, pe.Settings.MaxMemory) {
+		return utils.StatusMemoryLimit, fmt.Sprintf("Probe exceeded its memory limit of %d bytes", pe.Settings.MaxMemory)
+	}
+	return
+}
+
+// Errors reported by probes failing to allocate memory ( ENOMEM, perl,
+// bash, python, c++, ... ), lower cased
+var outOfMemoryErrors = []string{
+	"out of memory",
+	"cannot allocate",
+	"memory exhausted",
+	"memoryerror",
+	"bad_alloc",
+}
+
+// Percentage of the memory limit a probe must have used
+// to be deemed killed for exceeding it
+const memoryLimitRatio = 90
+
+// outOfMemory check if a probe failed because its address space limit
+// has been reached. Allocations fail with ENOMEM once the limit is
+// reached, most probes then exit with an error telling so. Probes killed
+// by a signal are only deemed out of memory if their peak memory usage
+// was close to the limit, other crashes keep their usual status.
+func outOfMemory(waitStatus syscall.WaitStatus, state *os.ProcessState, stderr []byte, maxMemory int) bool {
+	lower := bytes.ToLower(stderr)
+	for _, message := range outOfMemoryErrors {
+		if bytes.Contains(lower, []byte(message)) {
+			return true
+		}
+	}
+
+	if waitStatus.Signaled() && (waitStatus.Signal() == syscall.SIGKILL || waitStatus.Signal() == syscall.SIGSEGV || waitStatus.Signal() == syscall.SIGABRT) {
+		if rusage, ok := state.SysUsage().(*syscall.Rusage); ok && rusage.Maxrss*1024 >= int64(maxMemory)*memoryLimitRatio/100 {
+			return true
+		}
+	}
+	return false
+}
+
+// setrlimit set a resource limit of the current process
+func setrlimit(resource int, soft uint64, hard uint64) (err error) {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: soft, Max: hard})
+}
@@ -0,0 +1,173 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric is a value measured by a probe
+type Metric struct {
+	Tags  map[string]string `json:"Tags,omitempty"`
+	Value float64           `json:"Value"`
+
+	// Optional fields, mostly filled from nagios performance data
+	Name string     `json:"Name,omitempty"`
+	Unit string     `json:"Unit,omitempty"`
+	Warn *Threshold `json:"Warn,omitempty"`
+	Crit *Threshold `json:"Crit,omitempty"`
+	Min  *float64   `json:"Min,omitempty"`
+	Max  *float64   `json:"Max,omitempty"`
+}
+
+// UnmarshalJSON decode a metric, its value may be a
+// number or a numeric string ( eg : "Value":"26" )
+func (m *Metric) UnmarshalJSON(data []byte) (err error) {
+	type metric Metric
+	decoded := struct {
+		*metric
+		Value json.RawMessage `json:"Value"`
+	}{metric: (*metric)(m)}
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		return
+	}
+	m.Value, err = metricValue(decoded.Value)
+	return
+}
+
+// metricValue decode a metric value from a number or a numeric string
+func metricValue(data json.RawMessage) (value float64, err error) {
+	if len(data) == 0 || string(data) == "null" {
+		return
+	}
+	if err = json.Unmarshal(data, &value); err == nil {
+		return
+	}
+	var str string
+	if err = json.Unmarshal(data, &str); err != nil {
+		return 0, fmt.Errorf("Invalid metric value %s", data)
+	}
+	if value, err = strconv.ParseFloat(strings.TrimSpace(str), 64); err != nil {
+		return 0, fmt.Errorf("Invalid metric value %q", str)
+	}
+	return
+}
+
+// Metrics are the values measured by a probe. Besides a list of
+// metrics, legacy probes may report a single metric object or an
+// object of metrics or values by name ( eg : {"load1":0.5} ).
+// Metrics without a numeric value are ignored.
+type Metrics []*Metric
+
+// UnmarshalJSON decode the metrics of a probe in any of
+// the supported shapes, invalid metrics are ignored
+func (ms *Metrics) UnmarshalJSON(data []byte) (err error) {
+	*ms = nil
+
+	var list []json.RawMessage
+	if err = json.Unmarshal(data, &list); err == nil {
+		for _, item := range list {
+			if metric := decodeMetric("", item); metric != nil {
+				*ms = append(*ms, metric)
+			}
+		}
+		return
+	}
+
+	var object map[string]json.RawMessage
+	if err = json.Unmarshal(data, &object); err != nil {
+		// Neither a list nor an object ( eg : null )
+		return nil
+	}
+	if _, ok := object["Value"]; ok {
+		if metric := decodeMetric("", data); metric != nil {
+			*ms = append(*ms, metric)
+		}
+		return
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if metric := decodeMetric(name, object[name]); metric != nil {
+			*ms = append(*ms, metric)
+		}
+	}
+	return
+}
+
+// decodeMetric decode a metric object or a bare value, nil is
+// returned if it has no numeric value. The metric is named name
+// if it has no name of its own.
+func decodeMetric(name string, data json.RawMessage) (metric *Metric) {
+	metric = new(Metric)
+	if err := json.Unmarshal(data, metric); err != nil {
+		value, err := metricValue(data)
+		if err != nil {
+			return nil
+		}
+		metric = &Metric{Value: value}
+	}
+	if metric.Name == "" {
+		metric.Name = name
+	}
+	return
+}
+
+// Threshold is a range of values. A nil Start means negative
+// infinity and a nil End means infinity. A value outside of
+// the range raises an alert, or inside of it if Inside is set.
+type Threshold struct {
+	Start  *float64 `json:"Start,omitempty"`
+	End    *float64 `json:"End,omitempty"`
+	Inside bool     `json:"Inside,omitempty"`
+}
+
+// NewThreshold parse a threshold using the nagios range format
+// ( eg : "10", "10:", "~:10", "10:20", "@10:20" )
+func NewThreshold(str string) (threshold *Threshold, err error) {
+	threshold = new(Threshold)
+
+	if strings.HasPrefix(str, "@") {
+		threshold.Inside = true
+		str = str[1:]
+	}
+
+	start := "0"
+	end := str
+	if i := strings.Index(str, ":"); i >= 0 {
+		start = str[:i]
+		end = str[i+1:]
+	}
+
+	if start != "~" {
+		if threshold.Start, err = parseFloat(start); err != nil {
+			return nil, fmt.Errorf("Invalid threshold start %s : %s", start, err)
+		}
+	}
+	if end != "" {
+		if threshold.End, err = parseFloat(end); err != nil {
+			return nil, fmt.Errorf("Invalid threshold end %s : %s", end, err)
+		}
+	}
+	return
+}
+
+// Alert return true if the value raises an alert
+func (t *Threshold) Alert(value float64) bool {
+	inside := (t.Start == nil || value >= *t.Start) && (t.End == nil || value <= *t.End)
+	return inside == t.Inside
+}
+
+func parseFloat(str string) (value *float64, err error) {
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return
+	}
+	return &f, nil
+}
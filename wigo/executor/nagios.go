@@ -0,0 +1,192 @@
+package executor
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/utils"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Probe output modes
+const (
+	ModeWigo   = "wigo"
+	ModeNagios = "nagios"
+)
+
+// NagiosStatus map nagios plugin exit codes to wigo status codes.
+// Any other exit code is considered an error.
+var NagiosStatus = map[int]int{
+	0: utils.StatusOk,
+	1: utils.StatusWarn,
+	2: utils.StatusCrit,
+	3: utils.StatusError,
+}
+
+var nagiosValueRegexp = regexp.MustCompile(`^([-+]?[0-9]*\.?[0-9]+(?:[eE][-+]?[0-9]+)?)(.*)$`)
+
+// NewProbeResultFromNagios create a new ProbeResult from a nagios plugin
+// exit code and output. The first line of output is the message, the
+// following lines are the details, and anything after a pipe is
+// performance data :
+//
+//	TEXT | perfdata
+//	LONG TEXT
+//	LONG TEXT | perfdata
+//	perfdata
+func NewProbeResultFromNagios(exitCode int, output []byte) (pr *ProbeResult) {
+	pr = new(ProbeResult)
+	pr.ExitCode = exitCode
+	pr.Timestamp = time.Now().Unix()
+
+	if status, ok := NagiosStatus[exitCode]; ok {
+		pr.Status = status
+	} else {
+		pr.Status = utils.StatusError
+		pr.Reason = utils.StatusReasons[utils.StatusError]
+	}
+	pr.Level = utils.StatusCodeToString(pr.Status)
+
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+
+	// First line
+	text, perfdata := splitPerfdata(lines[0])
+	pr.Message = strings.TrimSpace(text)
+
+	// Long text is followed by performance data once a pipe is found
+	var details []string
+	inPerfdata := false
+	for _, line := range lines[1:] {
+		if inPerfdata {
+			perfdata += " " + line
+			continue
+		}
+		text, more := splitPerfdata(line)
+		details = append(details, text)
+		if strings.Contains(line, "|") {
+			perfdata += " " + more
+			inPerfdata = true
+		}
+	}
+	if len(details) > 0 {
+		pr.Details = strings.TrimSpace(strings.Join(details, "\n"))
+	}
+
+	pr.Metrics = ParseNagiosPerfdata(perfdata)
+	return
+}
+
+// ParseNagiosPerfdata parse nagios performance data into metrics.
+// Invalid or unknown ( "U" ) values are discarded.
+//
+//	'label'=value[UOM];[warn];[crit];[min];[max]
+func ParseNagiosPerfdata(perfdata string) (metrics []*Metric) {
+	for len(perfdata) > 0 {
+		perfdata = strings.TrimLeft(perfdata, " \t")
+		if perfdata == "" {
+			break
+		}
+
+		// Read label, it may be quoted to include spaces
+		var label string
+		if perfdata[0] == '\'' {
+			end := 1
+			for ; end < len(perfdata); end++ {
+				if perfdata[end] == '\'' {
+					// A doubled quote is an escaped quote
+					if end+1 < len(perfdata) && perfdata[end+1] == '\'' {
+						label += "'"
+						end++
+						continue
+					}
+					break
+				}
+				label += string(perfdata[end])
+			}
+			if end < len(perfdata) {
+				end++
+			}
+			perfdata = perfdata[end:]
+			if !strings.HasPrefix(perfdata, "=") {
+				log.Debugf("Invalid nagios perfdata for label %s", label)
+				continue
+			}
+			perfdata = perfdata[1:]
+		} else {
+			i := strings.Index(perfdata, "=")
+			if i < 0 {
+				log.Debugf("Invalid nagios perfdata %s", perfdata)
+				break
+			}
+			label = perfdata[:i]
+			perfdata = perfdata[i+1:]
+		}
+
+		// Read value up to the next space
+		value := perfdata
+		if i := strings.IndexAny(perfdata, " \t"); i >= 0 {
+			value = perfdata[:i]
+			perfdata = perfdata[i:]
+		} else {
+			perfdata = ""
+		}
+
+		metric, err := parseNagiosMetric(label, value)
+		if err != nil {
+			log.Debugf("Invalid nagios perfdata %s=%s : %s", label, value, err)
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return
+}
+
+// parseNagiosMetric parse a value[UOM];[warn];[crit];[min];[max] string
+func parseNagiosMetric(label string, str string) (metric *Metric, err error) {
+	fields := strings.Split(str, ";")
+
+	matches := nagiosValueRegexp.FindStringSubmatch(fields[0])
+	if matches == nil {
+		return nil, fmt.Errorf("Invalid value %s", fields[0])
+	}
+
+	metric = new(Metric)
+	metric.Name = label
+	metric.Unit = matches[2]
+	value, err := parseFloat(matches[1])
+	if err != nil {
+		return nil, err
+	}
+	metric.Value = *value
+
+	if len(fields) > 1 && fields[1] != "" {
+		if metric.Warn, err = NewThreshold(fields[1]); err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		if metric.Crit, err = NewThreshold(fields[2]); err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) > 3 && fields[3] != "" {
+		if metric.Min, err = parseFloat(fields[3]); err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) > 4 && fields[4] != "" {
+		if metric.Max, err = parseFloat(fields[4]); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// splitPerfdata split a line of nagios output on the first pipe
+func splitPerfdata(line string) (text string, perfdata string) {
+	if i := strings.Index(line, "|"); i >= 0 {
+		return line[:i], line[i+1:]
+	}
+	return line, ""
+}
@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"github.com/root-gg/wigo/wigo/utils"
+	"testing"
+)
+
+const nagiosOutput = `DISK OK - free space: / 3326 MB (56%); | /=2643MB;5948;5958;0;5968
+/ 15272 MB (77%);
+/boot 68 MB (69%); | /boot=68MB;88;93;0;98
+'/home dir'=69357MB;253404;253409;0;253414
+'load 1'=0.5;@10:20;~:30 broken=U`
+
+func TestNewProbeResultFromNagios(t *testing.T) {
+	pr := NewProbeResultFromNagios(1, []byte(nagiosOutput))
+
+	if pr.Status != utils.StatusWarn {
+		t.Fatalf("Invalid probe status %d, expected %d", pr.Status, utils.StatusWarn)
+	}
+
+	if pr.Message != "DISK OK - free space: / 3326 MB (56%);" {
+		t.Fatalf("Invalid probe message %s, expected %s", pr.Message, "DISK OK - free space: / 3326 MB (56%);")
+	}
+
+	if pr.Details != "/ 15272 MB (77%);\n/boot 68 MB (69%);" {
+		t.Fatalf("Invalid probe details %q", pr.Details)
+	}
+
+	if len(pr.Metrics) != 4 {
+		t.Fatalf("Invalid metric count %d, expected %d", len(pr.Metrics), 4)
+	}
+
+	metric := pr.Metrics[0]
+	if metric.Name != "/" || metric.Value != 2643 || metric.Unit != "MB" {
+		t.Fatalf("Invalid metric %s=%f%s", metric.Name, metric.Value, metric.Unit)
+	}
+	if metric.Warn == nil || *metric.Warn.End != 5948 || *metric.Warn.Start != 0 {
+		t.Fatal("Invalid metric warning threshold")
+	}
+	if metric.Min == nil || *metric.Min != 0 || metric.Max == nil || *metric.Max != 5968 {
+		t.Fatal("Invalid metric min/max")
+	}
+
+	if pr.Metrics[2].Name != "/home dir" {
+		t.Fatalf("Invalid metric name %s, expected %s", pr.Metrics[2].Name, "/home dir")
+	}
+
+	metric = pr.Metrics[3]
+	if metric.Name != "load 1" || metric.Value != 0.5 || metric.Unit != "" {
+		t.Fatalf("Invalid metric %s=%f%s", metric.Name, metric.Value, metric.Unit)
+	}
+	if !metric.Warn.Inside || metric.Crit.Start != nil || *metric.Crit.End != 30 {
+		t.Fatal("Invalid metric thresholds")
+	}
+}
+
+func TestNewProbeResultFromNagiosUnknownExitCode(t *testing.T) {
+	for _, exitCode := range []int{3, 26} {
+		pr := NewProbeResultFromNagios(exitCode, []byte("UNKNOWN - dummy"))
+		if pr.Status != utils.StatusError {
+			t.Fatalf("Invalid probe status %d, expected %d", pr.Status, utils.StatusError)
+		}
+		if pr.Metrics != nil {
+			t.Fatal("Probe result should not have any metric")
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	tests := []struct {
+		threshold string
+		value     float64
+		alert     bool
+	}{
+		{"10", 5, false},
+		{"10", 11, true},
+		{"10", -1, true},
+		{"10:", 5, true},
+		{"~:10", -100, false},
+		{"10:20", 15, false},
+		{"@10:20", 15, true},
+		{"@10:20", 25, false},
+	}
+
+	for _, test := range tests {
+		threshold, err := NewThreshold(test.threshold)
+		if err != nil {
+			t.Fatalf("Unable to parse threshold %s : %s", test.threshold, err)
+		}
+		if threshold.Alert(test.value) != test.alert {
+			t.Fatalf("Invalid alert for value %f and threshold %s, expected %t", test.value, test.threshold, test.alert)
+		}
+	}
+
+	if _, err := NewThreshold("foo"); err == nil {
+		t.Fatal("No error while parsing invalid threshold")
+	}
+}
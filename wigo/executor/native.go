@@ -0,0 +1,163 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NativeProbe is a probe running inside the wigo process
+// instead of being executed as a separate program
+type NativeProbe interface {
+	// Run the probe with its JSON configuration, which is empty
+	// if the probe has no configuration file. An error means the
+	// probe failed to check anything.
+	Run(config []byte) (result *ProbeResult, err error)
+}
+
+// NativeProbeConfig holds the configuration keys common to every
+// native probe. Native probes are disabled unless a configuration
+// file named after the probe exists in the probe config directory.
+type NativeProbeConfig struct {
+	Enabled  bool `json:"enabled"`
+	Interval int  `json:"interval"`
+}
+
+var nativeProbes = make(map[string]func() NativeProbe)
+var nativeProbesLock sync.Mutex
+
+// RegisterNativeProbe register a native probe factory
+// under a probe name. It is expected to be called from
+// the init function of the package implementing the probe.
+func RegisterNativeProbe(name string, factory func() NativeProbe) {
+	nativeProbesLock.Lock()
+	defer nativeProbesLock.Unlock()
+
+	if _, ok := nativeProbes[name]; ok {
+		panic(fmt.Sprintf("Native probe %s registered twice", name))
+	}
+	nativeProbes[name] = factory
+}
+
+// NativeProbes return the sorted names of every registered native probe
+func NativeProbes() (names []string) {
+	nativeProbesLock.Lock()
+	defer nativeProbesLock.Unlock()
+
+	for name := range nativeProbes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// NewNativeProbeExecutor create a new ProbeExecutor running the native
+// probe registered under name. The probe config is read from the probe
+// config directory, nil is returned if the probe is not enabled.
+func NewNativeProbeExecutor(name string) (pe *ProbeExecutor, err error) {
+	nativeProbesLock.Lock()
+	factory, ok := nativeProbes[name]
+	nativeProbesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown native probe %s", name)
+	}
+
+	data, err := utils.ReadProbeConfig(nativeProbeConfigPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	nc := new(NativeProbeConfig)
+	nc.Enabled = true
+	nc.Interval = 60
+	if err = json.Unmarshal(data, nc); err != nil {
+		return nil, fmt.Errorf("Invalid native probe %s config : %s", name, err)
+	}
+	if !nc.Enabled || nc.Interval <= 0 {
+		return
+	}
+
+	pe = NewProbeExecutor("", nc.Interval)
+	pe.Name = name
+	pe.Key = name
+	pe.Native = factory()
+	return
+}
+
+// nativeProbeConfigPath return the path of a native probe config file
+func nativeProbeConfigPath(name string) string {
+	return filepath.Join(GetEnvironment().ConfigRoot, name+".conf")
+}
+
+// executeNative run a native probe and always return a ProbeResult.
+// A native probe can't be killed, a timed out probe is left running in
+// the background and the probe is not run again until it has returned,
+// it keeps reporting a timeout meanwhile.
+func (pe *ProbeExecutor) executeNative() (probeResult *ProbeResult) {
+	pe.lock.Lock()
+	running := pe.running
+	pe.lock.Unlock()
+	if running != nil {
+		select {
+		case <-running:
+			pe.lock.Lock()
+			pe.running = nil
+			pe.lock.Unlock()
+		default:
+			log.Warnf("Native probe %s is still running since it timed out, skipping", pe.Name)
+			pe.updateStats()
+			return NewProbeResult(utils.StatusTimeout, -1, "Probe still running since it timed out", "")
+		}
+	}
+
+	data, err := pe.loadConfig()
+	if err != nil {
+		if data == nil {
+			log.Warnf("Native probe %s : %s", pe.Name, err)
+			return NewProbeResult(utils.StatusCannotRun, -1, err.Error(), "")
+		}
+		log.Warnf("Native probe %s : %s, using the last valid config", pe.Name, err)
+	}
+
+	done := make(chan *ProbeResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Warnf("Native probe %s panic : %v", pe.Name, r)
+				done <- NewProbeResult(utils.StatusPanic, -1, fmt.Sprintf("Probe panic : %v", r), "")
+			}
+		}()
+
+		result, err := pe.Native.Run(data)
+		if err != nil {
+			log.Warnf("Native probe %s failed : %s", pe.Name, err)
+			result = NewProbeResult(utils.StatusError, -1, err.Error(), "")
+		} else if result == nil {
+			result = NewProbeResult(utils.StatusInvalidResult, -1, "Probe returned no result", "")
+		} else {
+			result.Clean()
+		}
+		done <- result
+	}()
+
+	select {
+	case <-time.After(time.Duration(pe.Timeout) * time.Second):
+		log.Warnf("Native probe %s timed out after %ds", pe.Name, pe.Timeout)
+		probeResult = NewProbeResult(utils.StatusTimeout, -1, fmt.Sprintf("Probe timed out after %ds", pe.Timeout), "")
+		pe.lock.Lock()
+		pe.running = done
+		pe.lock.Unlock()
+	case probeResult = <-done:
+	}
+	pe.updateStats()
+	return
+}
@@ -0,0 +1,157 @@
+package executor
+
+import (
+	"errors"
+	"github.com/root-gg/wigo/wigo/utils"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type dummyNativeProbe struct {
+	runs int32
+}
+
+func (p *dummyNativeProbe) Run(config []byte) (result *ProbeResult, err error) {
+	atomic.AddInt32(&p.runs, 1)
+	switch string(config) {
+	case "":
+		result = NewProbeResult(utils.StatusOk, 0, "dummy", "")
+	case `{"error":true}`:
+		err = errors.New("dummy error")
+	case `{"panic":true}`:
+		panic("dummy panic")
+	case `{"sleep":true}`:
+		time.Sleep(2 * time.Second)
+	default:
+		result = NewProbeResult(utils.StatusWarn, 0, string(config), "")
+	}
+	return
+}
+
+func init() {
+	RegisterNativeProbe("dummy_native", func() NativeProbe { return new(dummyNativeProbe) })
+}
+
+func setupNativeProbeConfig(config string) (err error) {
+	return ioutil.WriteFile(tmpProbeConfigDir+"/dummy_native.conf", []byte(config), 0644)
+}
+
+func TestNativeProbes(t *testing.T) {
+	found := false
+	for _, name := range NativeProbes() {
+		if name == "dummy_native" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("Missing dummy_native native probe")
+	}
+}
+
+func TestNativeProbeNotEnabled(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	pe, err := NewNativeProbeExecutor("dummy_native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe != nil {
+		t.Fatal("Native probe without config file should not be enabled")
+	}
+
+	if err := setupNativeProbeConfig(`{"enabled":false}`); err != nil {
+		t.Fatalf("Unable to setup native probe config : %s", err)
+	}
+	if pe, _ = NewNativeProbeExecutor("dummy_native"); pe != nil {
+		t.Fatal("Disabled native probe should not be enabled")
+	}
+
+	if _, err = NewNativeProbeExecutor("unknown"); err == nil {
+		t.Fatal("No error while creating unknown native probe executor")
+	}
+}
+
+func TestExecuteNativeProbe(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	if err := setupNativeProbeConfig("{ # comment\n\"interval\":1}"); err != nil {
+		t.Fatalf("Unable to setup native probe config : %s", err)
+	}
+	pe, err := NewNativeProbeExecutor("dummy_native")
+	if err != nil || pe == nil {
+		t.Fatalf("Unable to create native probe executor : %s", err)
+	}
+	if pe.Timeout != 1 {
+		t.Fatalf("Invalid timeout %d, expected %d", pe.Timeout, 1)
+	}
+
+	result := pe.Execute()
+	if result.Status != utils.StatusWarn {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusWarn)
+	}
+	if result.Message != "{ \n\"interval\":1}" {
+		t.Fatalf("Invalid message %q", result.Message)
+	}
+	if result.Name != "dummy_native" {
+		t.Fatalf("Invalid probe name %s, expected %s", result.Name, "dummy_native")
+	}
+	if result.Internal {
+		t.Fatal("Native probe result should not be internal")
+	}
+
+	tests := map[string]int{
+		`{"error":true}`: utils.StatusError,
+		`{"panic":true}`: utils.StatusPanic,
+	}
+	for config, status := range tests {
+		if err := setupNativeProbeConfig(config); err != nil {
+			t.Fatalf("Unable to setup native probe config : %s", err)
+		}
+		result := pe.Execute()
+		if result.Status != status {
+			t.Fatalf("Invalid status %d for config %s, expected %d", result.Status, config, status)
+		}
+	}
+}
+
+func TestExecuteNativeProbeTimeout(t *testing.T) {
+	if err := setupProbeExecutorTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	if err := setupNativeProbeConfig(`{"sleep":true}`); err != nil {
+		t.Fatalf("Unable to setup native probe config : %s", err)
+	}
+	pe, err := NewNativeProbeExecutor("dummy_native")
+	if err != nil || pe == nil {
+		t.Fatalf("Unable to create native probe executor : %s", err)
+	}
+	pe.Timeout = 1
+	probe := pe.Native.(*dummyNativeProbe)
+
+	if result := pe.Execute(); result.Status != utils.StatusTimeout {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusTimeout)
+	}
+
+	// The probe is not run again while the timed out run has not returned
+	if err := setupNativeProbeConfig(""); err != nil {
+		t.Fatalf("Unable to setup native probe config : %s", err)
+	}
+	if result := pe.Execute(); result.Status != utils.StatusTimeout {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusTimeout)
+	}
+	if runs := atomic.LoadInt32(&probe.runs); runs != 1 {
+		t.Fatalf("Invalid run count %d, expected %d", runs, 1)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if result := pe.Execute(); result.Status != utils.StatusOk {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusOk)
+	}
+	if runs := atomic.LoadInt32(&probe.runs); runs != 2 {
+		t.Fatalf("Invalid run count %d, expected %d", runs, 2)
+	}
+}
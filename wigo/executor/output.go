@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// OutputBuffer capture a probe output stream up to a maximum
+// size. Everything written beyond the limit is discarded but
+// still accounted so it can be reported.
+type OutputBuffer struct {
+	buffer    bytes.Buffer
+	max       int
+	discarded int
+}
+
+// NewOutputBuffer create a new OutputBuffer keeping at most max bytes.
+// A max size of 0 or less means unlimited.
+func NewOutputBuffer(max int) (ob *OutputBuffer) {
+	ob = new(OutputBuffer)
+	ob.max = max
+	return
+}
+
+// Write implements io.Writer. It never returns a short write to
+// avoid breaking the probe output pipe when the limit is reached.
+func (ob *OutputBuffer) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if ob.max <= 0 {
+		ob.buffer.Write(p)
+		return
+	}
+
+	room := ob.max - ob.buffer.Len()
+	if room > len(p) {
+		room = len(p)
+	}
+	ob.buffer.Write(p[:room])
+	ob.discarded += len(p) - room
+	return
+}
+
+// Bytes return the captured output without truncation marker
+func (ob *OutputBuffer) Bytes() []byte {
+	return ob.buffer.Bytes()
+}
+
+// Truncated return true if some output has been discarded
+func (ob *OutputBuffer) Truncated() bool {
+	return ob.discarded > 0
+}
+
+// Discarded return the number of bytes that have been discarded
+func (ob *OutputBuffer) Discarded() int {
+	return ob.discarded
+}
+
+// String return the captured output with a truncation marker
+// appended if some output has been discarded
+func (ob *OutputBuffer) String() string {
+	if !ob.Truncated() {
+		return ob.buffer.String()
+	}
+	return ob.buffer.String() + fmt.Sprintf("\n[... truncated %d bytes]", ob.discarded)
+}
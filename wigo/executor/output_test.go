@@ -0,0 +1,41 @@
+package executor
+
+import (
+	"testing"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	ob := NewOutputBuffer(8)
+	for _, chunk := range []string{"dummy", "dummy"} {
+		n, err := ob.Write([]byte(chunk))
+		if err != nil {
+			t.Fatalf("Unable to write to output buffer : %s", err)
+		}
+		if n != len(chunk) {
+			t.Fatalf("Invalid write count %d, expected %d", n, len(chunk))
+		}
+	}
+	if string(ob.Bytes()) != "dummydum" {
+		t.Fatalf("Invalid output %s, expected %s", string(ob.Bytes()), "dummydum")
+	}
+	if !ob.Truncated() {
+		t.Fatal("Output buffer should be truncated")
+	}
+	if ob.Discarded() != 2 {
+		t.Fatalf("Invalid discarded count %d, expected %d", ob.Discarded(), 2)
+	}
+	if ob.String() != "dummydum\n[... truncated 2 bytes]" {
+		t.Fatalf("Invalid output %q, expected %q", ob.String(), "dummydum\n[... truncated 2 bytes]")
+	}
+}
+
+func TestUnlimitedOutputBuffer(t *testing.T) {
+	ob := NewOutputBuffer(0)
+	ob.Write([]byte("dummy"))
+	if ob.Truncated() {
+		t.Fatal("Unlimited output buffer should never be truncated")
+	}
+	if ob.String() != "dummy" {
+		t.Fatalf("Invalid output %s, expected %s", ob.String(), "dummy")
+	}
+}
@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"crypto/sha1"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Store persist the probes data between runs
+type Store interface {
+	Get(key string) (value []byte, err error)
+	Set(key string, value []byte) (err error)
+	Delete(key string) (err error)
+}
+
+var probeStore Store
+
+// SetStore set the store of the probes persistent data. Probes can
+// persist data only if a store has been set.
+func SetStore(store Store) {
+	probeStore = store
+}
+
+// persistKey return the key of the probe persistent data. The probe
+// path is used so probes with the same name do not collide.
+func (pe *ProbeExecutor) persistKey() string {
+	if pe.Native != nil {
+		return "native:" + pe.Name
+	}
+	return "probe:" + pe.Path
+}
+
+// statePath return the path of the file holding the data
+// persisted by the previous run of the probe
+func (pe *ProbeExecutor) statePath() string {
+	hash := sha1.Sum([]byte(pe.persistKey()))
+	return filepath.Join(GetEnvironment().StateRoot, fmt.Sprintf("%s-%x.state", pe.Name, hash[:4]))
+}
+
+// writeState write the data persisted by the previous run of the
+// probe to its state file, readable by the probe user only
+func (pe *ProbeExecutor) writeState(attr *syscall.SysProcAttr) (err error) {
+	if probeStore == nil {
+		return
+	}
+
+	value, err := probeStore.Get(pe.persistKey())
+	if err != nil {
+		return fmt.Errorf("Unable to get persistent data : %s", err)
+	}
+
+	// The directory can be traversed but not listed
+	root := GetEnvironment().StateRoot
+	if err = os.MkdirAll(root, 0711); err != nil {
+		return
+	}
+
+	path := pe.statePath()
+	if err = ioutil.WriteFile(path, value, 0600); err != nil {
+		return
+	}
+	if attr != nil && attr.Credential != nil {
+		err = os.Chown(path, int(attr.Credential.Uid), int(attr.Credential.Gid))
+	}
+	return
+}
+
+// saveState store the data persisted by the probe, if any,
+// and remove it from the result
+func (pe *ProbeExecutor) saveState(result *ProbeResult) {
+	if result.Persist == nil {
+		return
+	}
+	if probeStore != nil {
+		if err := probeStore.Set(pe.persistKey(), result.Persist); err != nil {
+			log.Warnf("Unable to save probe %s persistent data : %s", pe.Name, err)
+		}
+	}
+	result.Persist = nil
+}
+
+// deleteState remove the probe persistent data
+func (pe *ProbeExecutor) deleteState() {
+	if probeStore == nil {
+		return
+	}
+	if err := probeStore.Delete(pe.persistKey()); err != nil {
+		log.Warnf("Unable to delete probe %s persistent data : %s", pe.Name, err)
+	}
+	os.Remove(pe.statePath())
+}
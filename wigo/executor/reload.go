@@ -0,0 +1,80 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/utils"
+	"os"
+	"path/filepath"
+)
+
+// Reason of the result published when a probe is disabled by its config
+const disabledReason = "disabled"
+
+// configPath return the path of the probe config file
+func (pe *ProbeExecutor) configPath() string {
+	return filepath.Join(GetEnvironment().ConfigRoot, pe.Name+".conf")
+}
+
+// loadConfig read the probe config, nil if the probe has no config file.
+// The last valid config is returned along with the error if the config is
+// invalid. It is what native probes and probes in json input mode are given,
+// other probes read their config file themselves.
+func (pe *ProbeExecutor) loadConfig() (config []byte, err error) {
+	config, err = utils.ReadProbeConfig(pe.configPath())
+	if os.IsNotExist(err) {
+		config, err = nil, nil
+	} else if err != nil {
+		err = fmt.Errorf("Unable to read probe config : %s", err)
+	} else if len(bytes.TrimSpace(config)) > 0 && !json.Valid(config) {
+		err = fmt.Errorf("Invalid probe config %s", pe.configPath())
+	}
+
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	if err != nil {
+		return pe.config, err
+	}
+	pe.config = config
+	return
+}
+
+// Reload validate the probe config and run the probe right away
+// with it. The probe is not run if the config is invalid.
+func (pe *ProbeExecutor) Reload() (err error) {
+	if _, err = pe.loadConfig(); err != nil {
+		return
+	}
+
+	select {
+	case pe.wake <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// disabled return true if the probe config has a top-level
+// "enabled" key set to false
+func (pe *ProbeExecutor) disabled() bool {
+	config, err := pe.loadConfig()
+	if err != nil {
+		log.Warnf("Probe %s : %s", pe.Name, err)
+	}
+	return utils.IsProbeConfigDisabled(config)
+}
+
+// disabledResult is published once when the probe gets disabled,
+// no stale result is expected from a disabled probe
+func (pe *ProbeExecutor) disabledResult() (result *ProbeResult) {
+	log.Infof("Probe %s is disabled by its config, pausing", pe.Name)
+
+	result = NewProbeResult(utils.StatusOk, 0, "Probe is disabled", "")
+	result.Reason = disabledReason
+	result.Path = pe.Path
+	result.Name = pe.Key
+	pe.tag(result)
+	return
+}
@@ -2,35 +2,50 @@ package executor
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/root-gg/wigo/wigo/utils"
 	pathUtil "path"
-	"time"
 	"path/filepath"
+	"time"
 )
 
 // ProbeResult is the result from a probe execution
 type ProbeResult struct {
+	Path      string `json:"path"`
+	Name      string `json:"name"`
 	Version   string `json:"version"`
 	Message   string `json:"message"`
 	Timestamp int64  `json:"timestamp"`
 
-	Metrics interface{} `json:"metrics,omitempty"`
-	Details interface{} `json:"details,omitempty"`
+	Metrics Metrics           `json:"metrics,omitempty"`
+	Details interface{}       `json:"details,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+
+	// Data persisted by the probe until its next run
+	Persist json.RawMessage `json:"persist,omitempty"`
 
 	Status   int    `json:"status"`
 	Level    string `json:"level"`
 	ExitCode int    `json:"exitCode"`
 	Stdout   string `json:"stdout,omitempty"`
 	Stderr   string `json:"stderr,omitempty"`
+
+	// Set when the result has been produced by wigo
+	// instead of the probe itself
+	Internal bool   `json:"internal,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+
+	// Seconds after which the result is stale if
+	// no new result has been received
+	Ttl int `json:"ttl,omitempty"`
 }
 
 // NewProbeResult create a new handcrafted ProbeResult
 func NewProbeResult(status int, exitCode int, message string, details string) (pr *ProbeResult) {
 	pr = new(ProbeResult)
 
-	// Set Path and Name
-//	pr.SetName(path)
-
+	pr.Internal = true
+	pr.Reason = utils.StatusReasons[status]
 	pr.Status = status
 	pr.ExitCode = exitCode
 	pr.Message = message
@@ -62,21 +77,35 @@ func (pr *ProbeResult) ToJSON() (bytes []byte, err error) {
 	return json.Marshal(pr)
 }
 
-//// SetName set probe name from path and remove extension if any
-//func (pr *ProbeResult) SetName(path string){
-//	pr.Path = path
-//	fileName := pathUtil.Base(path)
-//	ext := filepath.Ext(fileName)
-//	pr.Name = fileName[0:len(fileName)-len(ext)]
-//}
+// SetName set probe name from path and remove extension if any
+func (pr *ProbeResult) SetName(path string) {
+	pr.Path = path
+	pr.Name = probeName(path)
+}
+
+// probeName return the probe file name without extension
+func probeName(path string) string {
+	fileName := pathUtil.Base(path)
+	ext := filepath.Ext(fileName)
+	return fileName[0 : len(fileName)-len(ext)]
+}
 
 // Clean override untrusted fields
-func (pr *ProbeResult) Clean(){
-//	pr.Path = ""
-//	pr.Name = ""
+func (pr *ProbeResult) Clean() {
+	pr.Path = ""
+	pr.Name = ""
 	pr.Timestamp = time.Now().Unix()
 	pr.ExitCode = 0
 	pr.Stdout = ""
 	pr.Stderr = ""
+	pr.Internal = false
+	pr.Reason = ""
+	pr.Ttl = 0
+
+	// Reserved status codes can only be produced by wigo
+	if utils.IsReservedStatus(pr.Status) {
+		pr.Message = fmt.Sprintf("Probe reported reserved status %d : %s", pr.Status, pr.Message)
+		pr.Status = utils.StatusError
+	}
 	pr.Level = utils.StatusCodeToString(pr.Status)
 }
\ No newline at end of file
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"github.com/root-gg/wigo/wigo/utils"
 	"testing"
 )
 
@@ -30,15 +31,7 @@ const invalidJSONResult = `
 `
 
 func TestNewResult(t *testing.T) {
-	pr := NewProbeResult("path/to/dummy.pl", 226, 26, "this is a dummy probe", "dummy dummy dummy")
-
-	if pr.Path != "path/to/dummy.pl" {
-		t.Fatalf("Invalid probe path %s, expected %s", pr.Path, "path/to/dummy.pl")
-	}
-
-	if pr.Name != "dummy" {
-		t.Fatalf("Invalid probe name %s, expected %s", pr.Name, "dummy")
-	}
+	pr := NewProbeResult(226, 26, "this is a dummy probe", "dummy dummy dummy")
 
 	if pr.Status != 226 {
 		t.Fatalf("Invalid probe status %d, expected %d", pr.Status, 226)
@@ -55,6 +48,38 @@ func TestNewResult(t *testing.T) {
 	if pr.Message != "this is a dummy probe" {
 		t.Fatalf("Invalid probe message %s, expected %s", pr.Message, "this is a dummy probe")
 	}
+
+	if !pr.Internal {
+		t.Fatal("Handcrafted probe result should be internal")
+	}
+}
+
+func TestNewInternalResult(t *testing.T) {
+	pr := NewProbeResult(utils.StatusTimeout, -1, "timeout", "")
+
+	if pr.Level != "UNKNOWN" {
+		t.Fatalf("Invalid probe level %s, expected %s", pr.Level, "UNKNOWN")
+	}
+
+	if pr.Reason != "timeout" {
+		t.Fatalf("Invalid probe reason %s, expected %s", pr.Reason, "timeout")
+	}
+}
+
+func TestCleanReservedStatus(t *testing.T) {
+	pr, err := NewProbeResultFromJSON([]byte(`{"status":997,"message":"dummy","internal":true}`))
+	if err != nil {
+		t.Fatalf("Unable to deserialize valid json result : %s", err)
+	}
+	pr.Clean()
+
+	if pr.Status != utils.StatusError {
+		t.Fatalf("Invalid probe status %d, expected %d", pr.Status, utils.StatusError)
+	}
+
+	if pr.Internal {
+		t.Fatal("Probe result should not be internal")
+	}
 }
 
 func TestNewResultFromJson(t *testing.T) {
@@ -87,3 +112,35 @@ func TestNewResultFromInvalidJson(t *testing.T) {
 	}
 	t.Fatal("Deserialized  invalid json result without error")
 }
+
+func TestNewResultFromJsonLegacyMetrics(t *testing.T) {
+	results := map[string][]float64{
+		`{"status":100,"metrics":[{"Value":"26","Tags":{"foo":"bar"}},{"Value":1.5},{"Value":"NaN?"}]}`: {26, 1.5},
+		`{"status":100,"metrics":{"Value":26}}`:                                                         {26},
+		`{"status":100,"metrics":{"load1":"0.5","load5":{"Value":1}}}`:                                  {0.5, 1},
+		`{"status":100,"metrics":[3,"4"]}`:                                                              {3, 4},
+		`{"status":100,"metrics":null}`:                                                                 {},
+	}
+	for result, values := range results {
+		pr, err := NewProbeResultFromJSON([]byte(result))
+		if err != nil {
+			t.Fatalf("Unable to deserialize result %s : %s", result, err)
+		}
+		if len(pr.Metrics) != len(values) {
+			t.Fatalf("Invalid metric count %d for %s, expected %d", len(pr.Metrics), result, len(values))
+		}
+		for i, value := range values {
+			if pr.Metrics[i].Value != value {
+				t.Fatalf("Invalid metric value %f for %s, expected %f", pr.Metrics[i].Value, result, value)
+			}
+		}
+	}
+
+	pr, _ := NewProbeResultFromJSON([]byte(`{"status":100,"metrics":{"load1":0.5}}`))
+	if pr.Metrics[0].Name != "load1" {
+		t.Fatalf("Invalid metric name %s, expected %s", pr.Metrics[0].Name, "load1")
+	}
+	if pr.Metrics[0].Tags != nil {
+		t.Fatalf("Invalid metric tags %v", pr.Metrics[0].Tags)
+	}
+}
@@ -0,0 +1,45 @@
+package global
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadUuid read the uuid of the agent from uuidFile. A random
+// uuid is generated and saved to uuidFile if it does not exist.
+func LoadUuid(uuidFile string) (uuid string, err error) {
+	data, err := ioutil.ReadFile(uuidFile)
+	if err == nil {
+		if uuid = strings.TrimSpace(string(data)); uuid == "" {
+			return "", fmt.Errorf("empty uuid in %s", uuidFile)
+		}
+		return
+	}
+	if !os.IsNotExist(err) {
+		return
+	}
+
+	if uuid, err = newUuid(); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(uuidFile), 0755); err != nil {
+		return
+	}
+	err = ioutil.WriteFile(uuidFile, []byte(uuid+"\n"), 0644)
+	return
+}
+
+// newUuid generate a random ( version 4 ) uuid
+func newUuid() (uuid string, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
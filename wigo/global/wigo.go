@@ -2,8 +2,10 @@ package global
 
 import (
 	"encoding/json"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
-	"github.com/root-gg/wigo/wigo/runner"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/utils"
 	"time"
 	"sync"
 )
@@ -14,17 +16,26 @@ type Wigo struct {
 	Version    string                         `json:"version"`
 	Alive      bool                           `json:"alive"`
 	Status     int                            `json:"status"`
-	Probes     map[string]*runner.ProbeResult `json:"probes"`
+	Probes     map[string]*executor.ProbeResult `json:"probes"`
 	Remotes    map[string]*Wigo               `json:"remotes"`
 	lastUpdate int64
 
+	// Names of passive probes
+	passive map[string]bool
+
+	// Timestamps after which the last result of
+	// a probe is stale, zero once reported
+	expiry map[string]int64
+
 	lock		sync.Mutex
 }
 
 func NewWigo() (w *Wigo) {
 	w = new(Wigo)
-	w.Probes = make(map[string]*runner.ProbeResult)
+	w.Probes = make(map[string]*executor.ProbeResult)
 	w.Remotes = make(map[string]*Wigo)
+	w.passive = make(map[string]bool)
+	w.expiry = make(map[string]int64)
 	w.Alive = true
 	w.Status = 100
 	return
@@ -48,37 +59,109 @@ func (w *Wigo) updateStatus() (status int) {
 	return
 }
 
-func (w *Wigo) RegisterProbe(probe *Probe) {
+func (w *Wigo) UpdateProbe(result *executor.ProbeResult) (oldResult *executor.ProbeResult) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	w.Probes[probe.Name] = probe
+	log.Debugf("Got status %d for probe %s", result.Status, result.Path)
+	oldResult = w.Probes[result.Name]
+	w.Probes[result.Name] = result
+	w.updateExpiry(result.Name, result.Ttl)
+	w.updateStatus()
+	return
+}
+
+// updateExpiry set the timestamp after which the last result of a
+// probe is stale. A zero ttl disables stale detection.
+func (w *Wigo) updateExpiry(name string, ttl int) {
+	if ttl == 0 {
+		w.expiry[name] = 0
+		return
+	}
+	w.expiry[name] = time.Now().Unix() + int64(ttl)
 }
 
-func (w *Wigo) UnregisterProbe(probe *Probe) {
+// RemoveProbe removes a probe and its last result
+func (w *Wigo) RemoveProbe(name string) (oldResult *executor.ProbeResult) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	delete(w.Probes,probe.name)
+	log.Debugf("Removing probe %s", name)
+	oldResult = w.Probes[name]
+	delete(w.Probes, name)
+	delete(w.passive, name)
+	delete(w.expiry, name)
+	w.updateStatus()
+	return
 }
 
-func (w *Wigo) UpdateProbe(result *runner.ProbeResult) (oldResult *runner.ProbeResult) {
+// SubmitPassiveProbe update a passive probe with a result submitted by
+// an external producer. The probe is marked stale if no new result is
+// submitted within ttl seconds. Probes run by wigo can't be updated.
+func (w *Wigo) SubmitPassiveProbe(name string, result *executor.ProbeResult, ttl int) (oldResult *executor.ProbeResult, err error) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	log.Debugf("Got status %d for probe %s", result.Status, result.Path)
-	oldResult = w.Probes[result.Name]
-
-	// 999 is a special status to remove a probe
-	if result.Status == 999 {
-		delete(w.Probes, result.Name)
-	} else {
-		w.Probes[result.Name] = result
+	if !w.passive[name] {
+		if _, ok := w.Probes[name]; ok {
+			return nil, fmt.Errorf("Probe %s is not a passive probe", name)
+		}
 	}
+
+	log.Debugf("Got status %d for passive probe %s", result.Status, name)
+	result.Name = name
+	result.Ttl = ttl
+	oldResult = w.Probes[name]
+	w.Probes[name] = result
+	w.passive[name] = true
+	w.updateExpiry(name, ttl)
 	w.updateStatus()
 	return
 }
 
+// RemovePassiveProbe removes a passive probe and its last result
+func (w *Wigo) RemovePassiveProbe(name string) (oldResult *executor.ProbeResult) {
+	w.lock.Lock()
+	ok := w.passive[name]
+	w.lock.Unlock()
+
+	if !ok {
+		return
+	}
+	return w.RemoveProbe(name)
+}
+
+// ExpiredProbes return a stale result for every probe without new
+// result within its ttl, the probe interval plus its timeout for
+// scheduled probes. This way a stuck scheduler or a dead producer is
+// never mistaken for a healthy probe. Each expiry is reported once.
+func (w *Wigo) ExpiredProbes() (results []*executor.ProbeResult) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	now := time.Now().Unix()
+	for name, expiry := range w.expiry {
+		if expiry == 0 || expiry > now {
+			continue
+		}
+		w.expiry[name] = 0
+
+		last := w.Probes[name]
+		since := time.Unix(last.Timestamp, 0).Format(time.RFC3339)
+		var result *executor.ProbeResult
+		if w.passive[name] {
+			result = executor.NewProbeResult(utils.StatusStale, -1, fmt.Sprintf("No result submitted since %s", since), "")
+		} else {
+			log.Warnf("Probe %s is stale", last.Path)
+			result = executor.NewProbeResult(utils.StatusStale, -1, fmt.Sprintf("No result since %s, the probe is not running", since), "")
+		}
+		result.Path = last.Path
+		result.Name = name
+		results = append(results, result)
+	}
+	return
+}
+
 func (w *Wigo) Deduplicate(remoteWigo *Wigo) {
 	for uuid, wigo := range remoteWigo.Remotes {
 		if uuid != wigo.Uuid {
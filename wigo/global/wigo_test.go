@@ -1,8 +1,10 @@
 package global
 
 import (
+	"os"
 	"testing"
-	"github.com/root-gg/wigo/wigo/runner"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/utils"
 )
 
 const validJSONWigo = `
@@ -138,9 +140,15 @@ func TestNewWigoFromInvalidJson(t *testing.T){
 	}
 }
 
+func newProbeResult(path string, status int) (pr *executor.ProbeResult) {
+	pr = executor.NewProbeResult(status, 0, "", "")
+	pr.SetName(path)
+	return
+}
+
 func TestUpdateProbe(t *testing.T){
 	w := NewWigo()
-	w.UpdateProbe(runner.NewProbeResult("/tmp/dummy.pl",226,0,"",""))
+	w.UpdateProbe(newProbeResult("/tmp/dummy.pl",226))
 	pr, ok := w.Probes["dummy"]
 	if !ok {
 		t.Fatal("Missing dummy probe")
@@ -155,15 +163,15 @@ func TestUpdateProbe(t *testing.T){
 
 func TestUpdateStatus(t *testing.T){
 	w := NewWigo()
-	w.UpdateProbe(runner.NewProbeResult("/tmp/dummy.pl",226,0,"",""))
+	w.UpdateProbe(newProbeResult("/tmp/dummy.pl",226))
 	if w.Status != 226 {
 		t.Fatalf("Invalid wigo status %d, expected %d", w.Status, 226)
 	}
-	w.UpdateProbe(runner.NewProbeResult("/tmp/dummy2.pl",100,0,"",""))
+	w.UpdateProbe(newProbeResult("/tmp/dummy2.pl",100))
 	if w.Status != 226 {
 		t.Fatalf("Invalid wigo status %d, expected %d", w.Status, 226)
 	}
-	w.UpdateProbe(runner.NewProbeResult("/tmp/dummy3.pl",326,0,"",""))
+	w.UpdateProbe(newProbeResult("/tmp/dummy3.pl",326))
 	if w.Status != 326 {
 		t.Fatalf("Invalid wigo status %d, expected %d", w.Status, 326)
 	}
@@ -171,19 +179,132 @@ func TestUpdateStatus(t *testing.T){
 
 func TestRemoveProbe(t *testing.T){
 	w := NewWigo()
-	w.UpdateProbe(runner.NewProbeResult("/tmp/dummy.pl",100,0,"",""))
+	w.UpdateProbe(newProbeResult("/tmp/dummy.pl",100))
 	_, ok := w.Probes["dummy"]
 	if !ok {
 		t.Fatal("Missing dummy probe")
 	}
-	w.UpdateProbe(runner.NewProbeResult("/tmp/dummy.pl",999,0,"",""))
+	w.RemoveProbe("dummy")
 	_, ok = w.Probes["dummy"]
 	if ok {
 		t.Fatal("Dummy probe has not been removed")
 	}
-	w.UpdateProbe(runner.NewProbeResult("/tmp/dummy2.pl",999,0,"",""))
+	w.RemoveProbe("dummy2")
 	_, ok = w.Probes["dummy2"]
 	if ok {
 		t.Fatal("Dummy probe2 has not been removed")
 	}
-}
\ No newline at end of file
+}
+
+func TestUpdateProbeStatFailed(t *testing.T){
+	w := NewWigo()
+	w.UpdateProbe(newProbeResult("/tmp/dummy.pl",999))
+	if _, ok := w.Probes["dummy"]; !ok {
+		t.Fatal("Probe with status 999 should not be removed")
+	}
+}
+func TestSubmitPassiveProbe(t *testing.T){
+	w := NewWigo()
+	w.UpdateProbe(newProbeResult("/tmp/dummy.pl",100))
+	if _, err := w.SubmitPassiveProbe("dummy", newProbeResult("",200), 60); err == nil {
+		t.Fatal("No error while submitting a result for a scheduled probe")
+	}
+
+	if _, err := w.SubmitPassiveProbe("backup", newProbeResult("",200), 60); err != nil {
+		t.Fatalf("Unable to submit passive probe result : %s", err)
+	}
+	if pr, ok := w.Probes["backup"]; !ok || pr.Name != "backup" {
+		t.Fatal("Missing passive probe backup")
+	}
+	if w.Status != 200 {
+		t.Fatalf("Invalid wigo status %d, expected %d", w.Status, 200)
+	}
+	if results := w.ExpiredProbes(); len(results) != 0 {
+		t.Fatalf("Invalid expired probes count %d, expected %d", len(results), 0)
+	}
+
+	w.RemovePassiveProbe("dummy")
+	if _, ok := w.Probes["dummy"]; !ok {
+		t.Fatal("Scheduled probe removed as a passive probe")
+	}
+	w.RemovePassiveProbe("backup")
+	if _, ok := w.Probes["backup"]; ok {
+		t.Fatal("Passive probe not removed")
+	}
+}
+
+func TestExpiredProbes(t *testing.T){
+	w := NewWigo()
+	w.SubmitPassiveProbe("backup", newProbeResult("",100), -1)
+
+	results := w.ExpiredProbes()
+	if len(results) != 1 {
+		t.Fatalf("Invalid expired probes count %d, expected %d", len(results), 1)
+	}
+	if results[0].Name != "backup" || results[0].Status != utils.StatusStale {
+		t.Fatalf("Invalid stale result %s %d", results[0].Name, results[0].Status)
+	}
+
+	// Expiry is reported once
+	w.UpdateProbe(results[0])
+	if results = w.ExpiredProbes(); len(results) != 0 {
+		t.Fatalf("Invalid expired probes count %d, expected %d", len(results), 0)
+	}
+
+	// Stale passive probes can be submitted again
+	if _, err := w.SubmitPassiveProbe("backup", newProbeResult("",100), 60); err != nil {
+		t.Fatalf("Unable to submit passive probe result : %s", err)
+	}
+}
+
+func TestExpiredScheduledProbes(t *testing.T){
+	w := NewWigo()
+	w.UpdateProbe(newProbeResult("/tmp/dummy.pl",100))
+	if results := w.ExpiredProbes(); len(results) != 0 {
+		t.Fatalf("Invalid expired probes count %d, expected %d", len(results), 0)
+	}
+
+	result := newProbeResult("/tmp/dummy.pl",100)
+	result.Ttl = -1
+	w.UpdateProbe(result)
+	results := w.ExpiredProbes()
+	if len(results) != 1 {
+		t.Fatalf("Invalid expired probes count %d, expected %d", len(results), 1)
+	}
+	if results[0].Name != "dummy" || results[0].Path != "/tmp/dummy.pl" || results[0].Status != utils.StatusStale {
+		t.Fatalf("Invalid stale result %s %d", results[0].Name, results[0].Status)
+	}
+	if results[0].Reason != "stale" {
+		t.Fatalf("Invalid stale result reason %s, expected %s", results[0].Reason, "stale")
+	}
+
+	// Expiry is reported once
+	w.UpdateProbe(results[0])
+	if w.Status != utils.StatusStale {
+		t.Fatalf("Invalid wigo status %d, expected %d", w.Status, utils.StatusStale)
+	}
+	if results = w.ExpiredProbes(); len(results) != 0 {
+		t.Fatalf("Invalid expired probes count %d, expected %d", len(results), 0)
+	}
+}
+
+func TestLoadUuid(t *testing.T){
+	uuidFile := "/tmp/wigo_uuid_test/uuid"
+	os.RemoveAll("/tmp/wigo_uuid_test")
+	defer os.RemoveAll("/tmp/wigo_uuid_test")
+
+	uuid, err := LoadUuid(uuidFile)
+	if err != nil {
+		t.Fatalf("Unable to generate uuid : %s", err)
+	}
+	if len(uuid) != 36 {
+		t.Fatalf("Invalid uuid %s", uuid)
+	}
+	loaded, err := LoadUuid(uuidFile)
+	if err != nil {
+		t.Fatalf("Unable to load uuid : %s", err)
+	}
+	if loaded != uuid {
+		t.Fatalf("Invalid uuid %s, expected %s", loaded, uuid)
+	}
+}
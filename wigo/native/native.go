@@ -0,0 +1,144 @@
+// Package native holds the helpers shared by the built-in native probes.
+// Each probe pack lives in a sub package registering its probes with
+// executor.RegisterNativeProbe from its init function.
+package native
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/utils"
+	"strings"
+)
+
+// Thresholds are the warn and crit ranges of a value, using the
+// nagios range format. An empty range never raises an alert.
+type Thresholds struct {
+	Warn string `json:"warn"`
+	Crit string `json:"crit"`
+}
+
+// NewThresholds create a new Thresholds instance
+func NewThresholds(warn string, crit string) (t *Thresholds) {
+	t = new(Thresholds)
+	t.Warn = warn
+	t.Crit = crit
+	return
+}
+
+// Status return the status code raised by a value
+func (t *Thresholds) Status(value float64) (status int, err error) {
+	warn, crit, err := t.parse()
+	if err != nil {
+		return
+	}
+
+	status = utils.StatusOk
+	if crit != nil && crit.Alert(value) {
+		status = utils.StatusCrit
+	} else if warn != nil && warn.Alert(value) {
+		status = utils.StatusWarn
+	}
+	return
+}
+
+func (t *Thresholds) parse() (warn *executor.Threshold, crit *executor.Threshold, err error) {
+	if t.Warn != "" {
+		if warn, err = executor.NewThreshold(t.Warn); err != nil {
+			return nil, nil, fmt.Errorf("Invalid warn threshold : %s", err)
+		}
+	}
+	if t.Crit != "" {
+		if crit, err = executor.NewThreshold(t.Crit); err != nil {
+			return nil, nil, fmt.Errorf("Invalid crit threshold : %s", err)
+		}
+	}
+	return
+}
+
+// LoadConfig unmarshal a native probe JSON config
+// into config, which holds the default values
+func LoadConfig(data []byte, config interface{}) (err error) {
+	if len(data) == 0 {
+		return
+	}
+	if err = json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("Invalid probe config : %s", err)
+	}
+	return
+}
+
+// Report accumulate the checks of a native probe and build
+// its ProbeResult. The status can only be raised.
+type Report struct {
+	Status  int
+	Metrics []*executor.Metric
+	Details map[string]interface{}
+
+	messages []string
+}
+
+// NewReport create a new Report instance
+func NewReport() (r *Report) {
+	r = new(Report)
+	r.Status = utils.StatusOk
+	r.Details = make(map[string]interface{})
+	return
+}
+
+// Raise the report status, the message is kept
+// if the status is not OK
+func (r *Report) Raise(status int, message string) {
+	if status > r.Status {
+		r.Status = status
+	}
+	if status != utils.StatusOk {
+		r.messages = append(r.messages, message)
+	}
+}
+
+// Check a value against its thresholds, raising the report status
+// and adding a metric. The label is used in the message if the value
+// raises an alert.
+func (r *Report) Check(label string, name string, value float64, unit string, tags map[string]string, thresholds *Thresholds) (err error) {
+	metric := new(executor.Metric)
+	metric.Name = name
+	metric.Value = value
+	metric.Unit = unit
+	metric.Tags = tags
+
+	status := utils.StatusOk
+	if thresholds != nil {
+		if metric.Warn, metric.Crit, err = thresholds.parse(); err != nil {
+			return fmt.Errorf("%s : %s", label, err)
+		}
+		if status, err = thresholds.Status(value); err != nil {
+			return
+		}
+	}
+	r.Metrics = append(r.Metrics, metric)
+	r.Raise(status, fmt.Sprintf("%s %s", label, FormatValue(value, unit)))
+	return
+}
+
+// Result build the ProbeResult, using message if everything is fine
+func (r *Report) Result(message string) (pr *executor.ProbeResult) {
+	pr = new(executor.ProbeResult)
+	pr.Status = r.Status
+	pr.Level = utils.StatusCodeToString(pr.Status)
+	pr.Message = message
+	if len(r.messages) > 0 {
+		pr.Message = strings.Join(r.messages, ", ")
+	}
+	pr.Metrics = r.Metrics
+	if len(r.Details) > 0 {
+		pr.Details = r.Details
+	}
+	return
+}
+
+// FormatValue format a value with two decimals at most
+func FormatValue(value float64, unit string) string {
+	str := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", value), "0"), ".")
+	return str + unit
+}
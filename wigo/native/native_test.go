@@ -0,0 +1,52 @@
+package native
+
+import (
+	"github.com/root-gg/wigo/wigo/utils"
+	"testing"
+)
+
+func TestThresholdsStatus(t *testing.T) {
+	thresholds := NewThresholds("80", "90")
+	tests := map[float64]int{
+		50: utils.StatusOk,
+		85: utils.StatusWarn,
+		95: utils.StatusCrit,
+	}
+	for value, expected := range tests {
+		status, err := thresholds.Status(value)
+		if err != nil {
+			t.Fatalf("Unable to check thresholds : %s", err)
+		}
+		if status != expected {
+			t.Fatalf("Invalid status %d for %f, expected %d", status, value, expected)
+		}
+	}
+
+	if _, err := NewThresholds("foo", "").Status(1); err == nil {
+		t.Fatal("No error with invalid threshold")
+	}
+}
+
+func TestReport(t *testing.T) {
+	report := NewReport()
+	if err := report.Check("a", "a", 50, "%", nil, NewThresholds("80", "90")); err != nil {
+		t.Fatalf("Unable to check value : %s", err)
+	}
+	result := report.Result("Fine")
+	if result.Status != utils.StatusOk || result.Message != "Fine" {
+		t.Fatalf("Invalid result %d %s", result.Status, result.Message)
+	}
+
+	report.Check("b", "b", 95.5, "%", nil, NewThresholds("80", "90"))
+	report.Check("c", "c", 85, "%", nil, NewThresholds("80", "90"))
+	result = report.Result("Fine")
+	if result.Status != utils.StatusCrit {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCrit)
+	}
+	if result.Message != "b 95.5%, c 85%" {
+		t.Fatalf("Invalid message %s", result.Message)
+	}
+	if len(result.Metrics) != 3 || result.Metrics[1].Crit == nil {
+		t.Fatalf("Invalid metrics %v", result.Metrics)
+	}
+}
@@ -0,0 +1,160 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DnsTarget is a DNS name to resolve. Type is the record type
+// ( A, AAAA, CNAME, MX, NS or TXT, default : A ) and Server the
+// name server to query ( eg : "8.8.8.8:53", default : system resolver ).
+// Every answer listed in Expect must be returned.
+type DnsTarget struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Server string   `json:"server"`
+	Expect []string `json:"expect"`
+	Target
+}
+
+// DnsConfig is the configuration of the dns probe
+type DnsConfig struct {
+	Targets []*DnsTarget `json:"targets"`
+}
+
+// DnsProbe check DNS resolution
+type DnsProbe struct{}
+
+// Run the dns probe
+func (p *DnsProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := new(DnsConfig)
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	report := native.NewReport()
+	for _, target := range config.Targets {
+		if target.Name == "" {
+			return nil, fmt.Errorf("Missing dns target name")
+		}
+		label := target.Name + " " + target.recordType()
+
+		start := time.Now()
+		answers, err := target.lookup()
+		if err != nil {
+			fail(report, label, err)
+			continue
+		}
+		latency := time.Since(start)
+
+		if missing := missingAnswers(answers, target.Expect); len(missing) > 0 {
+			fail(report, label, fmt.Errorf("missing answers %s", strings.Join(missing, " ")))
+			continue
+		}
+
+		report.Details[label] = answers
+		if err = checkLatency(report, label, &target.Target, latency); err != nil {
+			return nil, err
+		}
+	}
+
+	result = report.Result(fmt.Sprintf("%d dns targets resolved", len(config.Targets)))
+	return
+}
+
+func (target *DnsTarget) recordType() string {
+	if target.Type == "" {
+		return "A"
+	}
+	return strings.ToUpper(target.Type)
+}
+
+// resolver return the resolver querying the target name server
+func (target *DnsTarget) resolver() *net.Resolver {
+	if target.Server == "" {
+		return net.DefaultResolver
+	}
+
+	resolver := new(net.Resolver)
+	resolver.PreferGo = true
+	resolver.Dial = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		dialer := new(net.Dialer)
+		return dialer.DialContext(ctx, network, target.Server)
+	}
+	return resolver
+}
+
+// lookup resolve the target and return the sorted answers
+func (target *DnsTarget) lookup() (answers []string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), target.timeout())
+	defer cancel()
+
+	resolver := target.resolver()
+	switch target.recordType() {
+	case "A", "AAAA":
+		addrs, err := resolver.LookupIPAddr(ctx, target.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if (addr.IP.To4() != nil) == (target.recordType() == "A") {
+				answers = append(answers, addr.IP.String())
+			}
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, target.Name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, target.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, mx.Host)
+		}
+	case "NS":
+		nss, err := resolver.LookupNS(ctx, target.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			answers = append(answers, ns.Host)
+		}
+	case "TXT":
+		if answers, err = resolver.LookupTXT(ctx, target.Name); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported record type %s", target.Type)
+	}
+
+	if len(answers) == 0 {
+		return nil, fmt.Errorf("no %s record", target.recordType())
+	}
+	sort.Strings(answers)
+	return
+}
+
+// missingAnswers return the expected answers not found. Names
+// are compared without their trailing dot and case insensitively.
+func missingAnswers(answers []string, expected []string) (missing []string) {
+	found := make(map[string]bool)
+	for _, answer := range answers {
+		found[strings.ToLower(strings.TrimSuffix(answer, "."))] = true
+	}
+	for _, expect := range expected {
+		if !found[strings.ToLower(strings.TrimSuffix(expect, "."))] {
+			missing = append(missing, expect)
+		}
+	}
+	return
+}
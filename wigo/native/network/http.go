@@ -0,0 +1,136 @@
+package network
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxHttpBodySize is the maximum size of a body matched against a regexp
+const MaxHttpBodySize = 1048576
+
+// HttpTarget is an HTTP(S) endpoint to request. Status lists the
+// expected status codes ( default : 200 ) and Match is a regexp
+// the body must match.
+type HttpTarget struct {
+	Url      string            `json:"url"`
+	Method   string            `json:"method"`
+	Headers  map[string]string `json:"headers"`
+	Status   []int             `json:"status"`
+	Match    string            `json:"match"`
+	Insecure bool              `json:"insecure"`
+	Target
+}
+
+// HttpConfig is the configuration of the http probe
+type HttpConfig struct {
+	Targets []*HttpTarget `json:"targets"`
+}
+
+// HttpProbe check HTTP(S) endpoints status, body and latency
+type HttpProbe struct{}
+
+// Run the http probe
+func (p *HttpProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := new(HttpConfig)
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	report := native.NewReport()
+	for _, target := range config.Targets {
+		if target.Url == "" {
+			return nil, fmt.Errorf("Missing http target url")
+		}
+
+		var match *regexp.Regexp
+		if target.Match != "" {
+			if match, err = regexp.Compile(target.Match); err != nil {
+				return nil, fmt.Errorf("Invalid http target %s match : %s", target.Url, err)
+			}
+		}
+
+		start := time.Now()
+		status, body, err := target.request()
+		if err != nil {
+			fail(report, target.Url, err)
+			continue
+		}
+		latency := time.Since(start)
+
+		if !target.expected(status) {
+			fail(report, target.Url, fmt.Errorf("unexpected status %d", status))
+			continue
+		}
+		if match != nil && !match.Match(body) {
+			fail(report, target.Url, fmt.Errorf("body does not match %s", target.Match))
+			continue
+		}
+
+		report.Details[target.Url] = status
+		if err = checkLatency(report, target.Url, &target.Target, latency); err != nil {
+			return nil, err
+		}
+	}
+
+	result = report.Result(fmt.Sprintf("%d http targets ok", len(config.Targets)))
+	return
+}
+
+// request the target and return the response status and body
+func (target *HttpTarget) request() (status int, body []byte, err error) {
+	method := target.Method
+	if method == "" {
+		method = "GET"
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), target.Url, nil)
+	if err != nil {
+		return
+	}
+	for name, value := range target.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	// Connections are not reused between runs
+	transport := new(http.Transport)
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.DisableKeepAlives = true
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: target.Insecure}
+
+	client := new(http.Client)
+	client.Timeout = target.timeout()
+	client.Transport = transport
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err = ioutil.ReadAll(io.LimitReader(resp.Body, MaxHttpBodySize))
+	return resp.StatusCode, body, err
+}
+
+// expected return true if the status code is expected
+func (target *HttpTarget) expected(status int) bool {
+	if len(target.Status) == 0 {
+		return status == http.StatusOK
+	}
+	for _, s := range target.Status {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+// Package network is the built-in native probe pack checking network
+// services : TCP ports, HTTP(S) endpoints, DNS resolution and TLS
+// certificates expiry.
+//
+// Each probe checks the list of targets declared in its configuration
+// file ( eg : http.conf ) and reports the latency of every target.
+package network
+
+import (
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"github.com/root-gg/wigo/wigo/utils"
+	"time"
+)
+
+// DefaultTimeout is the default timeout of a target in seconds
+const DefaultTimeout = 5
+
+func init() {
+	executor.RegisterNativeProbe("tcp", func() executor.NativeProbe { return new(TcpProbe) })
+	executor.RegisterNativeProbe("http", func() executor.NativeProbe { return new(HttpProbe) })
+	executor.RegisterNativeProbe("dns", func() executor.NativeProbe { return new(DnsProbe) })
+	executor.RegisterNativeProbe("tls", func() executor.NativeProbe { return new(TlsProbe) })
+}
+
+// Target holds the configuration keys common to every target.
+// Thresholds apply to the latency in milliseconds.
+type Target struct {
+	Timeout int `json:"timeout"`
+	native.Thresholds
+}
+
+// timeout return the target timeout as a duration
+func (t *Target) timeout() time.Duration {
+	if t.Timeout <= 0 {
+		return DefaultTimeout * time.Second
+	}
+	return time.Duration(t.Timeout) * time.Second
+}
+
+// checkLatency check the latency of a target against its thresholds
+func checkLatency(report *native.Report, name string, target *Target, latency time.Duration) error {
+	ms := float64(latency) / float64(time.Millisecond)
+	tags := map[string]string{"target": name}
+	return report.Check(name+" latency", "latency", ms, "ms", tags, &target.Thresholds)
+}
+
+// fail raise a critical status for a target that could not be checked
+func fail(report *native.Report, name string, err error) {
+	report.Raise(utils.StatusCrit, fmt.Sprintf("%s : %s", name, err))
+	report.Details[name] = err.Error()
+}
@@ -0,0 +1,177 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/utils"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTcpProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen : %s", err)
+	}
+	address := listener.Addr().String()
+
+	config := fmt.Sprintf(`{"targets":[{"address":"%s"}]}`, address)
+	result, err := new(TcpProbe).Run([]byte(config))
+	if err != nil {
+		t.Fatalf("Unable to run tcp probe : %s", err)
+	}
+	if result.Status != utils.StatusOk {
+		t.Fatalf("Invalid status %d, expected %d : %s", result.Status, utils.StatusOk, result.Message)
+	}
+	if len(result.Metrics) != 1 || result.Metrics[0].Tags["target"] != address {
+		t.Fatalf("Invalid metrics %v", result.Metrics)
+	}
+
+	// Port closed
+	listener.Close()
+	result, err = new(TcpProbe).Run([]byte(config))
+	if err != nil {
+		t.Fatalf("Unable to run tcp probe : %s", err)
+	}
+	if result.Status != utils.StatusCrit {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCrit)
+	}
+}
+
+func TestHttpProbe(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("wigo is alive"))
+	})
+	mux.HandleFunc("/ko", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "wigo is dead", http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := map[string]int{
+		`{"url":"%s/ok","match":"alive"}`:                     utils.StatusOk,
+		`{"url":"%s/ok","match":"dead"}`:                      utils.StatusCrit,
+		`{"url":"%s/ko"}`:                                     utils.StatusCrit,
+		`{"url":"%s/ko","status":[500]}`:                      utils.StatusOk,
+		`{"url":"%s/ok","warn":"@0:10000"}`:                   utils.StatusWarn,
+		`{"url":"%s/ok","method":"HEAD","headers":{"a":"b"}}`: utils.StatusOk,
+	}
+	for target, status := range tests {
+		config := fmt.Sprintf(`{"targets":[`+target+`]}`, server.URL)
+		result, err := new(HttpProbe).Run([]byte(config))
+		if err != nil {
+			t.Fatalf("Unable to run http probe : %s", err)
+		}
+		if result.Status != status {
+			t.Fatalf("Invalid status %d for %s, expected %d : %s", result.Status, target, status, result.Message)
+		}
+	}
+}
+
+func TestTlsProbe(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	address := server.Listener.Addr().String()
+
+	// The test certificate is self signed
+	config := fmt.Sprintf(`{"targets":[{"address":"%s"}]}`, address)
+	result, err := new(TlsProbe).Run([]byte(config))
+	if err != nil {
+		t.Fatalf("Unable to run tls probe : %s", err)
+	}
+	if result.Status != utils.StatusCrit {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCrit)
+	}
+
+	config = fmt.Sprintf(`{"targets":[{"address":"%s","insecure":true}]}`, address)
+	result, err = new(TlsProbe).Run([]byte(config))
+	if err != nil {
+		t.Fatalf("Unable to run tls probe : %s", err)
+	}
+	if result.Status != utils.StatusOk {
+		t.Fatalf("Invalid status %d, expected %d : %s", result.Status, utils.StatusOk, result.Message)
+	}
+	if result.Metrics[0].Name != "expiry" || result.Metrics[0].Value < 365 {
+		t.Fatalf("Invalid expiry metric %v", result.Metrics[0])
+	}
+
+	config = fmt.Sprintf(`{"targets":[{"address":"%s","insecure":true,"expiry":{"warn":"1000000:"}}]}`, address)
+	result, err = new(TlsProbe).Run([]byte(config))
+	if err != nil {
+		t.Fatalf("Unable to run tls probe : %s", err)
+	}
+	if result.Status != utils.StatusWarn {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusWarn)
+	}
+}
+
+// startDnsServer start a name server answering 127.0.0.1
+// to every A query, and nothing to other queries
+func startDnsServer(t *testing.T) (conn net.PacketConn) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen : %s", err)
+	}
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			query := buffer[:n]
+
+			// Find the end of the question : name then type and class
+			end := 12
+			for end < n && query[end] != 0 {
+				end += int(query[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(query[end-4 : end-2])
+
+			response := append([]byte{}, query[:end]...)
+			binary.BigEndian.PutUint16(response[2:], 0x8180)
+			binary.BigEndian.PutUint16(response[8:], 0)
+			binary.BigEndian.PutUint16(response[10:], 0)
+			if qtype == 1 {
+				binary.BigEndian.PutUint16(response[6:], 1)
+				response = append(response, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 127, 0, 0, 1)
+			} else {
+				binary.BigEndian.PutUint16(response[6:], 0)
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return
+}
+
+func TestDnsProbe(t *testing.T) {
+	conn := startDnsServer(t)
+	defer conn.Close()
+	server := conn.LocalAddr().String()
+
+	tests := map[string]int{
+		`{"name":"wigo.test","server":"%s","expect":["127.0.0.1"]}`: utils.StatusOk,
+		`{"name":"wigo.test","server":"%s","expect":["127.0.0.2"]}`: utils.StatusCrit,
+		`{"name":"wigo.test","server":"%s","type":"AAAA"}`:          utils.StatusCrit,
+		`{"name":"wigo.test","server":"%s","type":"SRV"}`:           utils.StatusCrit,
+		`{"name":"wigo.test","server":"%s","warn":"@0:10000"}`:      utils.StatusWarn,
+	}
+	for target, status := range tests {
+		config := fmt.Sprintf(`{"targets":[`+target+`]}`, server)
+		result, err := new(DnsProbe).Run([]byte(config))
+		if err != nil {
+			t.Fatalf("Unable to run dns probe : %s", err)
+		}
+		if result.Status != status {
+			t.Fatalf("Invalid status %d for %s, expected %d : %s", result.Status, target, status, result.Message)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package network
+
+import (
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"net"
+	"time"
+)
+
+// TcpTarget is a TCP port to connect to ( eg : "localhost:22" )
+type TcpTarget struct {
+	Address string `json:"address"`
+	Target
+}
+
+// TcpConfig is the configuration of the tcp probe
+type TcpConfig struct {
+	Targets []*TcpTarget `json:"targets"`
+}
+
+// TcpProbe check that TCP ports accept connections
+type TcpProbe struct{}
+
+// Run the tcp probe
+func (p *TcpProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := new(TcpConfig)
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	report := native.NewReport()
+	for _, target := range config.Targets {
+		if target.Address == "" {
+			return nil, fmt.Errorf("Missing tcp target address")
+		}
+
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", target.Address, target.timeout())
+		if err != nil {
+			fail(report, target.Address, err)
+			continue
+		}
+		latency := time.Since(start)
+		conn.Close()
+
+		report.Details[target.Address] = "ok"
+		if err = checkLatency(report, target.Address, &target.Target, latency); err != nil {
+			return nil, err
+		}
+	}
+
+	result = report.Result(fmt.Sprintf("%d tcp targets reachable", len(config.Targets)))
+	return
+}
@@ -0,0 +1,97 @@
+package network
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"net"
+	"time"
+)
+
+// TlsTarget is a TLS endpoint whose certificate expiry is checked
+// ( eg : "example.com:443" ). Expiry thresholds apply to the number
+// of days before the first certificate of the chain expires.
+type TlsTarget struct {
+	Address    string             `json:"address"`
+	ServerName string             `json:"serverName"`
+	Insecure   bool               `json:"insecure"`
+	Expiry     *native.Thresholds `json:"expiry"`
+	Target
+}
+
+// TlsConfig is the configuration of the tls probe
+type TlsConfig struct {
+	Targets []*TlsTarget `json:"targets"`
+}
+
+// TlsProbe check TLS certificates expiry
+type TlsProbe struct{}
+
+// Run the tls probe
+func (p *TlsProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := new(TlsConfig)
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	report := native.NewReport()
+	for _, target := range config.Targets {
+		if target.Address == "" {
+			return nil, fmt.Errorf("Missing tls target address")
+		}
+		if target.Expiry == nil {
+			target.Expiry = native.NewThresholds("30:", "7:")
+		}
+
+		start := time.Now()
+		expiry, err := target.expiry()
+		if err != nil {
+			fail(report, target.Address, err)
+			continue
+		}
+		latency := time.Since(start)
+
+		days := time.Until(expiry).Hours() / 24
+		report.Details[target.Address] = expiry.UTC().Format(time.RFC3339)
+		tags := map[string]string{"target": target.Address}
+		if err = report.Check(target.Address+" certificate expiry", "expiry", days, "d", tags, target.Expiry); err != nil {
+			return nil, err
+		}
+		if err = checkLatency(report, target.Address, &target.Target, latency); err != nil {
+			return nil, err
+		}
+	}
+
+	result = report.Result(fmt.Sprintf("%d tls certificates valid", len(config.Targets)))
+	return
+}
+
+// expiry connect to the target and return the
+// expiry date of the certificate chain
+func (target *TlsTarget) expiry() (expiry time.Time, err error) {
+	dialer := new(net.Dialer)
+	dialer.Timeout = target.timeout()
+
+	tlsConfig := new(tls.Config)
+	tlsConfig.ServerName = target.ServerName
+	tlsConfig.InsecureSkipVerify = target.Insecure
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", target.Address, tlsConfig)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return expiry, fmt.Errorf("no certificate")
+	}
+	expiry = certificates[0].NotAfter
+	for _, certificate := range certificates[1:] {
+		if certificate.NotAfter.Before(expiry) {
+			expiry = certificate.NotAfter
+		}
+	}
+	return
+}
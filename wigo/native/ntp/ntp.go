@@ -0,0 +1,165 @@
+// Package ntp is the built-in native probe checking the clock offset
+// of the host against NTP servers. It is enabled by creating the
+// ntp.conf configuration file in the probe config directory.
+package ntp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"github.com/root-gg/wigo/wigo/utils"
+	"math"
+	"net"
+	"time"
+)
+
+// DefaultTimeout is the default timeout of a query in seconds
+const DefaultTimeout = 5
+
+// ntpEpochOffset is the number of seconds between
+// the NTP epoch ( 1900 ) and the unix epoch ( 1970 )
+const ntpEpochOffset = 2208988800
+
+func init() {
+	executor.RegisterNativeProbe("ntp", func() executor.NativeProbe { return new(NtpProbe) })
+}
+
+// NtpConfig is the configuration of the ntp probe. Thresholds apply
+// to the absolute clock offset in milliseconds. Servers default to
+// port 123.
+type NtpConfig struct {
+	Servers []string `json:"servers"`
+	Timeout int      `json:"timeout"`
+	native.Thresholds
+}
+
+// Response is the result of a NTP query. Offset is the
+// difference between the server clock and the local clock.
+type Response struct {
+	Offset  time.Duration
+	Delay   time.Duration
+	Stratum int
+}
+
+// NtpProbe check the clock offset against NTP servers
+type NtpProbe struct{}
+
+// Run the ntp probe
+func (p *NtpProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := new(NtpConfig)
+	config.Servers = []string{"pool.ntp.org"}
+	config.Timeout = DefaultTimeout
+	config.Warn = "100"
+	config.Crit = "1000"
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+	if len(config.Servers) == 0 {
+		return nil, fmt.Errorf("Missing ntp servers")
+	}
+
+	report := native.NewReport()
+	failed := 0
+	for _, server := range config.Servers {
+		response, err := Query(server, time.Duration(config.Timeout)*time.Second)
+		if err != nil {
+			failed++
+			report.Raise(utils.StatusWarn, fmt.Sprintf("%s : %s", server, err))
+			report.Details[server] = err.Error()
+			continue
+		}
+
+		offset := float64(response.Offset) / float64(time.Millisecond)
+		delay := float64(response.Delay) / float64(time.Millisecond)
+		report.Details[server] = map[string]interface{}{
+			"offset":  offset,
+			"delay":   delay,
+			"stratum": response.Stratum,
+		}
+
+		tags := map[string]string{"server": server}
+		if err = report.Check(server+" offset", "offset", math.Abs(offset), "ms", tags, &config.Thresholds); err != nil {
+			return nil, err
+		}
+		report.Check(server+" delay", "delay", delay, "ms", tags, nil)
+		report.Check(server+" stratum", "stratum", float64(response.Stratum), "", tags, nil)
+	}
+
+	if failed == len(config.Servers) {
+		report.Raise(utils.StatusCrit, "No ntp server reachable")
+	}
+
+	result = report.Result(fmt.Sprintf("Clock synchronized with %d ntp servers", len(config.Servers)))
+	return
+}
+
+// Query a NTP server using the SNTP protocol ( RFC 4330 )
+func Query(server string, timeout time.Duration) (response *Response, err error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Leap indicator 0, version 4, mode 3 ( client )
+	request := make([]byte, 48)
+	request[0] = 0x23
+
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(request[40:], toNtpTime(t1))
+	if _, err = conn.Write(request); err != nil {
+		return
+	}
+
+	packet := make([]byte, 48)
+	for {
+		var n int
+		if n, err = conn.Read(packet); err != nil {
+			return
+		}
+		t4 := time.Now()
+
+		// Discard responses to other requests
+		if n < 48 || binary.BigEndian.Uint64(packet[24:]) != binary.BigEndian.Uint64(request[40:]) {
+			continue
+		}
+		if mode := packet[0] & 0x07; mode != 4 {
+			return nil, fmt.Errorf("invalid response mode %d", mode)
+		}
+		if packet[0]>>6 == 3 {
+			return nil, fmt.Errorf("server clock is not synchronized")
+		}
+
+		response = new(Response)
+		response.Stratum = int(packet[1])
+		if response.Stratum == 0 || response.Stratum > 15 {
+			return nil, fmt.Errorf("invalid stratum %d", response.Stratum)
+		}
+
+		t2 := fromNtpTime(binary.BigEndian.Uint64(packet[32:]))
+		t3 := fromNtpTime(binary.BigEndian.Uint64(packet[40:]))
+		response.Offset = (t2.Sub(t1) + t3.Sub(t4)) / 2
+		response.Delay = t4.Sub(t1) - t3.Sub(t2)
+		return
+	}
+}
+
+// toNtpTime convert a time to a NTP timestamp
+func toNtpTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// fromNtpTime convert a NTP timestamp to a time
+func fromNtpTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanoseconds := int64((ntp & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(seconds, nanoseconds)
+}
@@ -0,0 +1,106 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/utils"
+	"net"
+	"testing"
+	"time"
+)
+
+// startNtpServer start a NTP server whose clock is ahead of
+// the local clock by offset, reporting the given stratum
+func startNtpServer(t *testing.T, offset time.Duration, stratum byte) (conn net.PacketConn) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen : %s", err)
+	}
+
+	go func() {
+		request := make([]byte, 48)
+		for {
+			n, addr, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+
+			now := toNtpTime(time.Now().Add(offset))
+			response := make([]byte, 48)
+			response[0] = 0x24 // version 4, mode 4 ( server )
+			response[1] = stratum
+			copy(response[24:32], request[40:48])
+			binary.BigEndian.PutUint64(response[32:], now)
+			binary.BigEndian.PutUint64(response[40:], now)
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return
+}
+
+func TestNtpTime(t *testing.T) {
+	now := time.Unix(1420070400, 500000000)
+	if converted := fromNtpTime(toNtpTime(now)); !converted.Equal(now) {
+		t.Fatalf("Invalid converted time %s, expected %s", converted, now)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	conn := startNtpServer(t, 2*time.Second, 2)
+	defer conn.Close()
+
+	response, err := Query(conn.LocalAddr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("Unable to query ntp server : %s", err)
+	}
+	if response.Offset < 1900*time.Millisecond || response.Offset > 2100*time.Millisecond {
+		t.Fatalf("Invalid offset %s, expected %s", response.Offset, 2*time.Second)
+	}
+	if response.Stratum != 2 {
+		t.Fatalf("Invalid stratum %d, expected %d", response.Stratum, 2)
+	}
+	if response.Delay < 0 || response.Delay > 100*time.Millisecond {
+		t.Fatalf("Invalid delay %s", response.Delay)
+	}
+}
+
+func TestNtpProbe(t *testing.T) {
+	synchronized := startNtpServer(t, 0, 1)
+	defer synchronized.Close()
+	late := startNtpServer(t, -500*time.Millisecond, 1)
+	defer late.Close()
+	broken := startNtpServer(t, 0, 0)
+	defer broken.Close()
+
+	tests := map[string]int{
+		synchronized.LocalAddr().String(): utils.StatusOk,
+		late.LocalAddr().String():         utils.StatusWarn,
+		broken.LocalAddr().String():       utils.StatusCrit,
+	}
+	for server, status := range tests {
+		config := fmt.Sprintf(`{"servers":["%s"],"timeout":1}`, server)
+		result, err := new(NtpProbe).Run([]byte(config))
+		if err != nil {
+			t.Fatalf("Unable to run ntp probe : %s", err)
+		}
+		if result.Status != status {
+			t.Fatalf("Invalid status %d for %s, expected %d : %s", result.Status, server, status, result.Message)
+		}
+	}
+
+	// One server out of two is broken
+	config := fmt.Sprintf(`{"servers":["%s","%s"],"timeout":1}`, synchronized.LocalAddr(), broken.LocalAddr())
+	result, err := new(NtpProbe).Run([]byte(config))
+	if err != nil {
+		t.Fatalf("Unable to run ntp probe : %s", err)
+	}
+	if result.Status != utils.StatusWarn {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusWarn)
+	}
+	if len(result.Metrics) != 3 {
+		t.Fatalf("Invalid metrics count %d, expected %d", len(result.Metrics), 3)
+	}
+}
@@ -0,0 +1,68 @@
+package system
+
+import (
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"sync"
+)
+
+// CpuProbe check the cpu usage since the previous run,
+// or since boot on the first run
+type CpuProbe struct {
+	previous []float64
+	lock     sync.Mutex
+}
+
+// Run the cpu probe
+func (p *CpuProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := native.NewThresholds("90", "")
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	// cpu  user nice system idle iowait irq softirq steal guest guest_nice
+	fields, err := readProcFields("stat")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read cpu stats : %s", err)
+	}
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return nil, fmt.Errorf("Invalid cpu stats %v", fields)
+	}
+	current, err := parseProcFloats(fields[1:])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cpu stats : %s", err)
+	}
+
+	p.lock.Lock()
+	previous := p.previous
+	p.previous = current
+	p.lock.Unlock()
+
+	// Guest time is already accounted in user time
+	if len(current) > 8 {
+		current = current[:8]
+	}
+
+	var total, idle float64
+	for i, value := range current {
+		if i < len(previous) {
+			value -= previous[i]
+		}
+		total += value
+
+		// idle and iowait
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	usage := 100 - percent(idle, total)
+
+	report := native.NewReport()
+	if err = report.Check("cpu usage", "usage", usage, "%", nil, config); err != nil {
+		return
+	}
+
+	result = report.Result(fmt.Sprintf("Cpu usage %s", native.FormatValue(usage, "%")))
+	return
+}
@@ -0,0 +1,178 @@
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"github.com/root-gg/wigo/wigo/utils"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// DefaultExcludedFsTypes are the pseudo filesystems and the network
+// filesystems not checked by default. A hung network filesystem would
+// block statfs and time the probe out.
+var DefaultExcludedFsTypes = []string{
+	"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs", "debugfs",
+	"devpts", "devtmpfs", "fusectl", "hugetlbfs", "mqueue", "nsfs", "proc",
+	"pstore", "rpc_pipefs", "securityfs", "squashfs", "sysfs", "tmpfs", "tracefs",
+	"9p", "afs", "ceph", "cifs", "fuse.sshfs", "glusterfs", "lustre", "nfs", "nfs4",
+	"smb3", "smbfs",
+}
+
+// DisksConfig is the configuration of the disks probe. If Mountpoints
+// is not empty only those mountpoints are checked.
+type DisksConfig struct {
+	native.Thresholds
+	Inodes             *native.Thresholds `json:"inodes"`
+	Mountpoints        []string           `json:"mountpoints"`
+	ExcludeMountpoints []string           `json:"excludeMountpoints"`
+	ExcludeFsTypes     []string           `json:"excludeFsTypes"`
+}
+
+// Mount is a mounted filesystem
+type Mount struct {
+	Device     string
+	Mountpoint string
+	FsType     string
+}
+
+// DisksProbe check the space and inodes used on every mountpoint
+type DisksProbe struct{}
+
+// Run the disks probe
+func (p *DisksProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := new(DisksConfig)
+	config.Warn = "85"
+	config.Crit = "95"
+	config.Inodes = native.NewThresholds("85", "95")
+	// Decoding the configuration writes into the slice, copy the defaults
+	config.ExcludeFsTypes = append([]string(nil), DefaultExcludedFsTypes...)
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	mounts, err := readMounts()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read mounts : %s", err)
+	}
+
+	report := native.NewReport()
+	checked := 0
+	for _, mount := range mounts {
+		if !config.check(mount) {
+			continue
+		}
+
+		stat := new(syscall.Statfs_t)
+		if err := syscall.Statfs(mount.Mountpoint, stat); err != nil {
+			report.Raise(utils.StatusCrit, fmt.Sprintf("%s unable to statfs : %s", mount.Mountpoint, err))
+			continue
+		}
+		if stat.Blocks == 0 {
+			continue
+		}
+		checked++
+
+		tags := map[string]string{"mountpoint": mount.Mountpoint}
+
+		// Space used as reported by df, blocks reserved to root excluded
+		used := stat.Blocks - stat.Bfree
+		space := percent(float64(used), float64(used+stat.Bavail))
+		if err = report.Check(mount.Mountpoint+" space", "space", space, "%", tags, &config.Thresholds); err != nil {
+			return
+		}
+
+		// Some filesystems do not have inodes
+		if stat.Files > 0 {
+			inodes := percent(float64(stat.Files-stat.Ffree), float64(stat.Files))
+			if err = report.Check(mount.Mountpoint+" inodes", "inodes", inodes, "%", tags, config.Inodes); err != nil {
+				return
+			}
+		}
+
+		report.Details[mount.Mountpoint] = map[string]interface{}{
+			"device": mount.Device,
+			"type":   mount.FsType,
+			"size":   stat.Blocks * uint64(stat.Bsize),
+			"free":   stat.Bavail * uint64(stat.Bsize),
+		}
+	}
+
+	result = report.Result(fmt.Sprintf("%d mountpoints checked", checked))
+	return
+}
+
+// check return true if the mount has to be checked
+func (config *DisksConfig) check(mount *Mount) bool {
+	if len(config.Mountpoints) > 0 {
+		return contains(config.Mountpoints, mount.Mountpoint)
+	}
+	return !contains(config.ExcludeMountpoints, mount.Mountpoint) && !contains(config.ExcludeFsTypes, mount.FsType)
+}
+
+// readMounts read /proc/mounts. When a mountpoint is mounted
+// several times only the last mount is kept.
+func readMounts() (mounts []*Mount, err error) {
+	file, err := os.Open(procPath("mounts"))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// /dev/sda1 / ext4 rw,relatime 0 0
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		mount := new(Mount)
+		mount.Device = unescapeMount(fields[0])
+		mount.Mountpoint = unescapeMount(fields[1])
+		mount.FsType = fields[2]
+
+		if i, ok := index[mount.Mountpoint]; ok {
+			mounts[i] = mount
+			continue
+		}
+		index[mount.Mountpoint] = len(mounts)
+		mounts = append(mounts, mount)
+	}
+	err = scanner.Err()
+	return
+}
+
+// unescapeMount decode the octal escapes of /proc/mounts ( eg : \040 for space )
+func unescapeMount(str string) string {
+	if !strings.Contains(str, "\\") {
+		return str
+	}
+
+	var unescaped []byte
+	for i := 0; i < len(str); i++ {
+		if str[i] == '\\' && i+3 < len(str) {
+			if c, err := strconv.ParseUint(str[i+1:i+4], 8, 8); err == nil {
+				unescaped = append(unescaped, byte(c))
+				i += 3
+				continue
+			}
+		}
+		unescaped = append(unescaped, str[i])
+	}
+	return string(unescaped)
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package system
+
+import (
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+)
+
+// FdsProbe check the percentage of the system wide
+// maximum number of file descriptors opened
+type FdsProbe struct{}
+
+// Run the fds probe
+func (p *FdsProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := native.NewThresholds("80", "90")
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	// allocated unused max
+	fields, err := readProcFields("sys", "fs", "file-nr")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file descriptors stats : %s", err)
+	}
+	values, err := parseProcFloats(fields)
+	if err != nil || len(values) < 3 {
+		return nil, fmt.Errorf("Invalid file descriptors stats %v", fields)
+	}
+
+	open := values[0] - values[1]
+	max := values[2]
+	used := percent(open, max)
+
+	report := native.NewReport()
+	report.Details["open"] = open
+	report.Details["max"] = max
+	if err = report.Check("file descriptors used", "used", used, "%", nil, config); err != nil {
+		return
+	}
+
+	result = report.Result(fmt.Sprintf("%.0f file descriptors open of %.0f", open, max))
+	return
+}
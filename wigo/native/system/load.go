@@ -0,0 +1,61 @@
+package system
+
+import (
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"runtime"
+)
+
+// LoadConfig is the configuration of the load probe.
+// If PerCpu is set the load averages are divided by the
+// number of cpus before being checked.
+type LoadConfig struct {
+	PerCpu bool `json:"perCpu"`
+	native.Thresholds
+}
+
+// LoadProbe check the 1, 5 and 15 minutes load averages
+type LoadProbe struct{}
+
+// Run the load probe
+func (p *LoadProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := new(LoadConfig)
+	config.PerCpu = true
+	config.Warn = "2"
+	config.Crit = "4"
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	// 0.20 0.18 0.12 1/80 11206
+	fields, err := readProcFields("loadavg")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read load average : %s", err)
+	}
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("Invalid load average %v", fields)
+	}
+	loads, err := parseProcFloats(fields[:3])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid load average : %s", err)
+	}
+
+	report := native.NewReport()
+	cpus := runtime.NumCPU()
+	report.Details["cpus"] = cpus
+	for i, name := range []string{"load1", "load5", "load15"} {
+		report.Details[name] = loads[i]
+
+		value := loads[i]
+		if config.PerCpu {
+			value = value / float64(cpus)
+		}
+		if err = report.Check(name, name, value, "", nil, &config.Thresholds); err != nil {
+			return
+		}
+	}
+
+	result = report.Result(fmt.Sprintf("Load average %s %s %s", fields[0], fields[1], fields[2]))
+	return
+}
@@ -0,0 +1,79 @@
+package system
+
+import (
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+)
+
+// MemoryProbe check the percentage of memory used,
+// page cache and buffers excluded
+type MemoryProbe struct{}
+
+// Run the memory probe
+func (p *MemoryProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := native.NewThresholds("90", "95")
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read memory info : %s", err)
+	}
+
+	total := meminfo["MemTotal"]
+	if total <= 0 {
+		return nil, fmt.Errorf("Invalid total memory %.0f kB", total)
+	}
+
+	// MemAvailable is only reported since linux 3.14
+	available, ok := meminfo["MemAvailable"]
+	if !ok {
+		available = meminfo["MemFree"] + meminfo["Buffers"] + meminfo["Cached"]
+	}
+	used := percent(total-available, total)
+
+	report := native.NewReport()
+	report.Details["total"] = total * 1024
+	report.Details["available"] = available * 1024
+	if err = report.Check("memory used", "used", used, "%", nil, config); err != nil {
+		return
+	}
+
+	result = report.Result(fmt.Sprintf("Memory used %s of %.0f MB", native.FormatValue(used, "%"), total/1024))
+	return
+}
+
+// SwapProbe check the percentage of swap used
+type SwapProbe struct{}
+
+// Run the swap probe
+func (p *SwapProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := native.NewThresholds("50", "80")
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read memory info : %s", err)
+	}
+
+	report := native.NewReport()
+	total := meminfo["SwapTotal"]
+	if total <= 0 {
+		result = report.Result("No swap")
+		return
+	}
+
+	used := percent(total-meminfo["SwapFree"], total)
+	report.Details["total"] = total * 1024
+	report.Details["free"] = meminfo["SwapFree"] * 1024
+	if err = report.Check("swap used", "used", used, "%", nil, config); err != nil {
+		return
+	}
+
+	result = report.Result(fmt.Sprintf("Swap used %s of %.0f MB", native.FormatValue(used, "%"), total/1024))
+	return
+}
@@ -0,0 +1,94 @@
+package system
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/native"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+)
+
+// ProcessConfig is the configuration of a process checked by the
+// processes probe. Thresholds apply to the number of running
+// processes, by default at least one must be running.
+type ProcessConfig struct {
+	Name string `json:"name"`
+	native.Thresholds
+}
+
+// ProcessesConfig is the configuration of the processes probe
+type ProcessesConfig struct {
+	Processes []*ProcessConfig `json:"processes"`
+}
+
+// ProcessesProbe check the presence of processes by name
+type ProcessesProbe struct{}
+
+// Run the processes probe
+func (p *ProcessesProbe) Run(data []byte) (result *executor.ProbeResult, err error) {
+	config := new(ProcessesConfig)
+	if err = native.LoadConfig(data, config); err != nil {
+		return
+	}
+
+	counts, err := countProcesses()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list processes : %s", err)
+	}
+
+	report := native.NewReport()
+	for _, process := range config.Processes {
+		if process.Name == "" {
+			return nil, fmt.Errorf("Missing process name")
+		}
+
+		thresholds := &process.Thresholds
+		if thresholds.Warn == "" && thresholds.Crit == "" {
+			thresholds = native.NewThresholds("", "1:")
+		}
+
+		count := counts[process.Name]
+		report.Details[process.Name] = count
+		tags := map[string]string{"process": process.Name}
+		if err = report.Check(process.Name+" processes", "count", float64(count), "", tags, thresholds); err != nil {
+			return
+		}
+	}
+
+	result = report.Result(fmt.Sprintf("%d processes checked", len(config.Processes)))
+	return
+}
+
+// countProcesses count the running processes by name. A process
+// is counted under both its command name and its executable name.
+func countProcesses() (counts map[string]int, err error) {
+	dirs, err := ioutil.ReadDir(ProcRoot)
+	if err != nil {
+		return
+	}
+
+	counts = make(map[string]int)
+	for _, dir := range dirs {
+		if _, err := strconv.Atoi(dir.Name()); err != nil || !dir.IsDir() {
+			continue
+		}
+
+		// Processes may exit while being listed
+		names := make(map[string]bool)
+		if comm, err := ioutil.ReadFile(procPath(dir.Name(), "comm")); err == nil {
+			names[string(bytes.TrimSpace(comm))] = true
+		}
+		if cmdline, err := ioutil.ReadFile(procPath(dir.Name(), "cmdline")); err == nil && len(cmdline) > 0 {
+			argv0 := bytes.SplitN(cmdline, []byte{0}, 2)[0]
+			names[filepath.Base(string(argv0))] = true
+		}
+		for name := range names {
+			if name != "" {
+				counts[name]++
+			}
+		}
+	}
+	return
+}
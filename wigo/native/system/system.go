@@ -0,0 +1,103 @@
+// Package system is the built-in native probe pack checking the
+// baseline health of a host : load, cpu, memory, swap, disks,
+// processes and open file descriptors.
+//
+// Probes read /proc and statfs and are enabled by creating their
+// configuration file ( eg : load.conf ) in the probe config directory.
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcRoot is the mount point of the proc filesystem
+var ProcRoot = "/proc"
+
+func init() {
+	executor.RegisterNativeProbe("load", func() executor.NativeProbe { return new(LoadProbe) })
+	executor.RegisterNativeProbe("cpu", func() executor.NativeProbe { return new(CpuProbe) })
+	executor.RegisterNativeProbe("memory", func() executor.NativeProbe { return new(MemoryProbe) })
+	executor.RegisterNativeProbe("swap", func() executor.NativeProbe { return new(SwapProbe) })
+	executor.RegisterNativeProbe("disks", func() executor.NativeProbe { return new(DisksProbe) })
+	executor.RegisterNativeProbe("processes", func() executor.NativeProbe { return new(ProcessesProbe) })
+	executor.RegisterNativeProbe("fds", func() executor.NativeProbe { return new(FdsProbe) })
+}
+
+// procPath return the path of a file in the proc filesystem
+func procPath(elem ...string) string {
+	return filepath.Join(append([]string{ProcRoot}, elem...)...)
+}
+
+// readProcFields read the whitespace separated fields of the
+// first line of a file in the proc filesystem
+func readProcFields(elem ...string) (fields []string, err error) {
+	file, err := os.Open(procPath(elem...))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if scanner.Scan() {
+		fields = strings.Fields(scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if len(fields) == 0 {
+		err = fmt.Errorf("%s is empty", procPath(elem...))
+	}
+	return
+}
+
+// parseProcFloats parse the fields of a proc file as floats
+func parseProcFloats(fields []string) (values []float64, err error) {
+	for _, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value %s : %s", field, err)
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// readMeminfo read /proc/meminfo into a map of values in kB
+func readMeminfo() (meminfo map[string]float64, err error) {
+	file, err := os.Open(procPath("meminfo"))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	meminfo = make(map[string]float64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// MemTotal:        8061180 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		meminfo[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	err = scanner.Err()
+	return
+}
+
+// percent return the ratio of value to total in percent
+func percent(value float64, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return value * 100 / total
+}
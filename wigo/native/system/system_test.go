@@ -0,0 +1,201 @@
+package system
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const tmpProcRoot = "/tmp/wigo_proc_test"
+
+var procFiles = map[string]string{
+	"loadavg":        "0.50 1.50 3.50 1/80 11206\n",
+	"stat":           "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 100 0 100 700 100 0 0 0 0 0\n",
+	"sys/fs/file-nr": "1000\t0\t10000\n",
+	"mounts":         "/dev/root / ext4 rw 0 0\nproc /proc proc rw 0 0\n",
+	"meminfo": "MemTotal:        1000000 kB\nMemFree:          100000 kB\nMemAvailable:     200000 kB\n" +
+		"SwapTotal:        100000 kB\nSwapFree:          40000 kB\n",
+	"1/comm":    "sshd\n",
+	"1/cmdline": "/usr/sbin/sshd\x00-D\x00",
+	"2/comm":    "kworker\n",
+	"3/comm":    "sshd\n",
+}
+
+func setupSystemProbeTest() (err error) {
+	if err = os.RemoveAll(tmpProcRoot); err != nil {
+		log.Errorf("Unable to remove test proc directory %s : %s", tmpProcRoot, err)
+		return
+	}
+	for name, content := range procFiles {
+		path := filepath.Join(tmpProcRoot, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			return
+		}
+	}
+	ProcRoot = tmpProcRoot
+	return
+}
+
+func TestLoadProbe(t *testing.T) {
+	if err := setupSystemProbeTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	result, err := new(LoadProbe).Run([]byte(`{"perCpu":false,"warn":"1","crit":"3"}`))
+	if err != nil {
+		t.Fatalf("Unable to run load probe : %s", err)
+	}
+	if result.Status != utils.StatusCrit {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCrit)
+	}
+	if result.Message != "load5 1.5, load15 3.5" {
+		t.Fatalf("Invalid message %s", result.Message)
+	}
+	if len(result.Metrics) != 3 || result.Metrics[2].Value != 3.5 {
+		t.Fatalf("Invalid metrics %v", result.Metrics)
+	}
+}
+
+func TestCpuProbe(t *testing.T) {
+	if err := setupSystemProbeTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	probe := new(CpuProbe)
+	result, err := probe.Run(nil)
+	if err != nil {
+		t.Fatalf("Unable to run cpu probe : %s", err)
+	}
+	if result.Metrics[0].Value != 20 {
+		t.Fatalf("Invalid cpu usage %f, expected %d", result.Metrics[0].Value, 20)
+	}
+
+	// Usage since the previous run
+	stat := "cpu  200 0 190 710 100 0 0 0 0 0\n"
+	if err := ioutil.WriteFile(filepath.Join(tmpProcRoot, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = probe.Run(nil)
+	if err != nil {
+		t.Fatalf("Unable to run cpu probe : %s", err)
+	}
+	if result.Metrics[0].Value != 95 {
+		t.Fatalf("Invalid cpu usage %f, expected %d", result.Metrics[0].Value, 95)
+	}
+	if result.Status != utils.StatusWarn {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusWarn)
+	}
+}
+
+func TestMemoryProbe(t *testing.T) {
+	if err := setupSystemProbeTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	result, err := new(MemoryProbe).Run(nil)
+	if err != nil {
+		t.Fatalf("Unable to run memory probe : %s", err)
+	}
+	if result.Status != utils.StatusOk || result.Metrics[0].Value != 80 {
+		t.Fatalf("Invalid memory result %d %s", result.Status, result.Message)
+	}
+
+	result, err = new(SwapProbe).Run(nil)
+	if err != nil {
+		t.Fatalf("Unable to run swap probe : %s", err)
+	}
+	if result.Status != utils.StatusWarn || result.Message != "swap used 60%" {
+		t.Fatalf("Invalid swap result %d %s", result.Status, result.Message)
+	}
+}
+
+func TestDisksProbe(t *testing.T) {
+	if err := setupSystemProbeTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	result, err := new(DisksProbe).Run([]byte(`{"warn":"@0:100"}`))
+	if err != nil {
+		t.Fatalf("Unable to run disks probe : %s", err)
+	}
+	if result.Status != utils.StatusWarn {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusWarn)
+	}
+	if result.Metrics[0].Tags["mountpoint"] != "/" {
+		t.Fatalf("Invalid metric tags %v", result.Metrics[0].Tags)
+	}
+	details := result.Details.(map[string]interface{})
+	if _, ok := details["/proc"]; ok {
+		t.Fatal("Excluded filesystem type has been checked")
+	}
+}
+
+func TestDisksProbeDefaults(t *testing.T) {
+	if err := setupSystemProbeTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	defaults := append([]string(nil), DefaultExcludedFsTypes...)
+	for _, data := range []string{`{"excludeFsTypes":["ext4"]}`, `{}`} {
+		if _, err := new(DisksProbe).Run([]byte(data)); err != nil {
+			t.Fatalf("Unable to run disks probe : %s", err)
+		}
+		if strings.Join(DefaultExcludedFsTypes, ",") != strings.Join(defaults, ",") {
+			t.Fatalf("Default excluded filesystem types changed to %v", DefaultExcludedFsTypes)
+		}
+	}
+
+	// The default exclusions apply again after a custom configuration
+	result, err := new(DisksProbe).Run([]byte(`{"warn":"@0:100"}`))
+	if err != nil {
+		t.Fatalf("Unable to run disks probe : %s", err)
+	}
+	if _, ok := result.Details.(map[string]interface{})["/proc"]; ok {
+		t.Fatal("Excluded filesystem type has been checked")
+	}
+}
+
+func TestUnescapeMount(t *testing.T) {
+	if str := unescapeMount(`/mnt/my\040disk`); str != "/mnt/my disk" {
+		t.Fatalf("Invalid unescaped mountpoint %s", str)
+	}
+}
+
+func TestProcessesProbe(t *testing.T) {
+	if err := setupSystemProbeTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	config := `{"processes":[{"name":"sshd","warn":"3:"},{"name":"cron"}]}`
+	result, err := new(ProcessesProbe).Run([]byte(config))
+	if err != nil {
+		t.Fatalf("Unable to run processes probe : %s", err)
+	}
+	if result.Status != utils.StatusCrit {
+		t.Fatalf("Invalid status %d, expected %d", result.Status, utils.StatusCrit)
+	}
+	if result.Message != "sshd processes 2, cron processes 0" {
+		t.Fatalf("Invalid message %s", result.Message)
+	}
+}
+
+func TestFdsProbe(t *testing.T) {
+	if err := setupSystemProbeTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	result, err := new(FdsProbe).Run(nil)
+	if err != nil {
+		t.Fatalf("Unable to run fds probe : %s", err)
+	}
+	if result.Status != utils.StatusOk || result.Metrics[0].Value != 10 {
+		t.Fatalf("Invalid fds result %d %s", result.Status, result.Message)
+	}
+}
@@ -0,0 +1,60 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// PersistPath return the path of the file holding persistent data.
+// When the agent manages persistent data it provides the path of
+// the file holding the data persisted by the previous run.
+func (p *Probe) PersistPath() string {
+	if path := os.Getenv("WIGO_PROBE_PERSIST_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join(PersistRoot, p.Name+".wigo")
+}
+
+// Persist save data to be restored by the next run of the probe. When
+// the agent manages persistent data it is returned in the probe result.
+func (p *Probe) Persist(data interface{}) (err error) {
+	if p.persist, err = json.Marshal(data); err != nil {
+		return fmt.Errorf("can't serialize persistant data : %s", err)
+	}
+	if os.Getenv("WIGO_PROBE_PERSIST_FILE") != "" {
+		p.Result.Persist = p.persist
+		return
+	}
+	if err = ioutil.WriteFile(p.PersistPath(), append(p.persist, '\n'), 0600); err != nil {
+		return fmt.Errorf("can't open persistant data file %s for writing : %s", p.PersistPath(), err)
+	}
+	return
+}
+
+// Restore unmarshal the data persisted by the previous run of the
+// probe into data. It return false if nothing has been persisted.
+func (p *Probe) Restore(data interface{}) (ok bool, err error) {
+	if len(p.persist) == 0 {
+		return false, nil
+	}
+	if err = json.Unmarshal(p.persist, data); err != nil {
+		return false, fmt.Errorf("can't deserialize persistant data : %s", err)
+	}
+	return true, nil
+}
+
+// restore read the data persisted by the previous run of the probe
+func (p *Probe) restore() (err error) {
+	data, err := ioutil.ReadFile(p.PersistPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("can't open persistant data file %s for reading : %s", p.PersistPath(), err)
+	}
+	p.persist = data
+	return
+}
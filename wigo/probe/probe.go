@@ -0,0 +1,198 @@
+// Package probe helps writing wigo probes in Go. It mirrors the
+// Wigo::Probe perl library :
+//
+//	func main() {
+//		config := &Config{Warn: 80}
+//		p := probe.Init(config)
+//
+//		p.Message("dummy")
+//		p.Raise(200)
+//		p.AddMetric(&executor.Metric{Tags: map[string]string{"foo": "bar"}, Value: 26})
+//
+//		p.Output(0)
+//	}
+//
+// The probe configuration is read from WIGO_PROBE_CONFIG_ROOT/<name>.conf
+// and the result is printed as JSON on stdout. Running the probe with
+// --debug pretty prints the result and enables Debugf output.
+package probe
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Version is the version of the result format
+const Version = "0.10"
+
+// ExitDisabled is the exit code of a disabled probe
+const ExitDisabled = 12
+
+// DefaultConfigRoot is used if WIGO_PROBE_CONFIG_ROOT is not set
+const DefaultConfigRoot = "/etc/wigo/conf.d"
+
+// PersistRoot is the directory holding persistent data
+var PersistRoot = "/tmp"
+
+// Output and exit can be replaced by tests
+var stdout io.Writer = os.Stdout
+var exit = os.Exit
+
+// Probe holds the state of a running probe
+type Probe struct {
+	Name   string
+	Args   []string
+	Debug  bool
+	Result *executor.ProbeResult
+
+	persist []byte
+}
+
+// New create a new Probe instance from the command line arguments
+func New(args []string) (p *Probe) {
+	p = new(Probe)
+
+	fileName := filepath.Base(args[0])
+	p.Name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+
+	flags := flag.NewFlagSet(p.Name, flag.ContinueOnError)
+	flags.BoolVar(&p.Debug, "debug", false, "Pretty print result and show debug output")
+	flags.SetOutput(ioutil.Discard)
+	if err := flags.Parse(args[1:]); err != nil {
+		p.Args = args[1:]
+	} else {
+		p.Args = flags.Args()
+	}
+
+	p.Result = new(executor.ProbeResult)
+	p.Result.Version = Version
+	p.Result.Status = utils.StatusOk
+	p.Result.Details = make(map[string]interface{})
+	return
+}
+
+// Init create a new Probe instance from os.Args, load its configuration
+// into config, which holds the default values, and restore its persistent
+// data. On error the probe outputs an error status and exits.
+func Init(config interface{}) (p *Probe) {
+	p = New(os.Args)
+
+	if err := p.LoadConfig(config); err != nil {
+		p.Status(utils.StatusError)
+		p.Message(err.Error())
+		p.Output(1)
+	}
+	if err := p.restore(); err != nil {
+		p.Status(utils.StatusCrit)
+		p.Message(err.Error())
+		p.Output(1)
+	}
+	return
+}
+
+// ConfigPath return the path of the probe configuration file
+func (p *Probe) ConfigPath() string {
+	root := os.Getenv("WIGO_PROBE_CONFIG_ROOT")
+	if root == "" {
+		root = DefaultConfigRoot
+	}
+	return filepath.Join(root, p.Name+".conf")
+}
+
+// LoadConfig load the probe configuration into config. Missing
+// configuration files are ignored. If the configuration has an
+// "enabled" key set to false the probe outputs and exits with
+// ExitDisabled.
+func (p *Probe) LoadConfig(config interface{}) (err error) {
+	data, err := utils.ReadProbeConfig(p.ConfigPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("Error while opening json config file for read : %s", err)
+	}
+
+	if err = json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("Error while decoding json config : %s", err)
+	}
+
+	if utils.IsProbeConfigDisabled(data) {
+		p.Message("Probe is disabled")
+		p.Output(ExitDisabled)
+	}
+	return
+}
+
+// Status set the probe status
+func (p *Probe) Status(status int) {
+	p.Result.Status = status
+}
+
+// Raise the probe status, it is never lowered
+func (p *Probe) Raise(status int) {
+	if status > p.Result.Status {
+		p.Result.Status = status
+	}
+}
+
+// Message set the probe message
+func (p *Probe) Message(message string) {
+	p.Result.Message = message
+}
+
+// Details return the probe details, a map unless replaced by SetDetails
+func (p *Probe) Details() map[string]interface{} {
+	details, _ := p.Result.Details.(map[string]interface{})
+	return details
+}
+
+// SetDetails replace the probe details
+func (p *Probe) SetDetails(details interface{}) {
+	p.Result.Details = details
+}
+
+// AddMetric add a metric to the probe result
+func (p *Probe) AddMetric(metric *executor.Metric) {
+	p.Result.Metrics = append(p.Result.Metrics, metric)
+}
+
+// Debugf print a message in debug mode only
+func (p *Probe) Debugf(format string, args ...interface{}) {
+	if p.Debug {
+		fmt.Fprintf(stdout, format, args...)
+	}
+}
+
+// Output print the probe result as JSON and exit with code
+func (p *Probe) Output(code int) {
+	p.Result.Level = utils.StatusCodeToString(p.Result.Status)
+	if details, ok := p.Result.Details.(map[string]interface{}); ok && len(details) == 0 {
+		p.Result.Details = nil
+	}
+
+	var data []byte
+	var err error
+	if p.Debug {
+		data, err = json.MarshalIndent(p.Result, "", "  ")
+	} else {
+		data, err = json.Marshal(p.Result)
+	}
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"status":  utils.StatusError,
+			"message": fmt.Sprintf("Unable to serialize result : %s", err),
+		})
+		code = 1
+	}
+
+	fmt.Fprintf(stdout, "%s\n", data)
+	exit(code)
+}
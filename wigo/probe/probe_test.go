@@ -0,0 +1,184 @@
+package probe
+
+import (
+	"bytes"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/utils"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const tmpProbeConfigDir = "/tmp/wigo_probe_config_test"
+
+type testConfig struct {
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+// setupProbeTest write the probe configuration and capture
+// the probe output and exit code
+func setupProbeTest(config string) (output *bytes.Buffer, code *int, err error) {
+	if err = os.RemoveAll(tmpProbeConfigDir); err != nil {
+		return
+	}
+	if err = os.MkdirAll(tmpProbeConfigDir, 0755); err != nil {
+		return
+	}
+	if config != "" {
+		if err = ioutil.WriteFile(tmpProbeConfigDir+"/test.conf", []byte(config), 0644); err != nil {
+			return
+		}
+	}
+	os.Setenv("WIGO_PROBE_CONFIG_ROOT", tmpProbeConfigDir)
+	PersistRoot = tmpProbeConfigDir
+
+	output = new(bytes.Buffer)
+	stdout = output
+	code = new(int)
+	*code = -1
+	exit = func(c int) { *code = c }
+	return
+}
+
+func TestNew(t *testing.T) {
+	p := New([]string{"/usr/local/wigo/probes/60/test.go", "--debug", "foo"})
+	if p.Name != "test" {
+		t.Fatalf("Invalid probe name %s, expected %s", p.Name, "test")
+	}
+	if !p.Debug {
+		t.Fatal("Debug mode not enabled")
+	}
+	if len(p.Args) != 1 || p.Args[0] != "foo" {
+		t.Fatalf("Invalid probe arguments %v", p.Args)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	_, code, err := setupProbeTest("{\n\"message\" : \"foo\" # comment\n}")
+	if err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	config := &testConfig{Message: "default", Status: 200}
+	p := New([]string{"test"})
+	if err := p.LoadConfig(config); err != nil {
+		t.Fatalf("Unable to load config : %s", err)
+	}
+	if config.Message != "foo" || config.Status != 200 {
+		t.Fatalf("Invalid config %v", config)
+	}
+	if *code != -1 {
+		t.Fatalf("Probe exited with code %d", *code)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	output, code, err := setupProbeTest(`{"enabled":false}`)
+	if err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	p := New([]string{"test"})
+	p.LoadConfig(new(testConfig))
+	if *code != ExitDisabled {
+		t.Fatalf("Invalid exit code %d, expected %d", *code, ExitDisabled)
+	}
+	if !bytes.Contains(output.Bytes(), []byte("Probe is disabled")) {
+		t.Fatalf("Invalid output %s", output)
+	}
+}
+
+func TestRaise(t *testing.T) {
+	p := New([]string{"test"})
+	p.Raise(utils.StatusCrit)
+	p.Raise(utils.StatusWarn)
+	if p.Result.Status != utils.StatusCrit {
+		t.Fatalf("Invalid status %d, expected %d", p.Result.Status, utils.StatusCrit)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	output, code, err := setupProbeTest("")
+	if err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	p := New([]string{"test"})
+	p.Message("dummy")
+	p.Raise(utils.StatusWarn)
+	p.Details()["foo"] = "bar"
+	p.AddMetric(&executor.Metric{Tags: map[string]string{"foo": "bar"}, Value: 26})
+	p.Output(0)
+
+	if *code != 0 {
+		t.Fatalf("Invalid exit code %d, expected %d", *code, 0)
+	}
+	result, err := executor.NewProbeResultFromJSON(output.Bytes())
+	if err != nil {
+		t.Fatalf("Unable to deserialize probe result : %s", err)
+	}
+	if result.Status != utils.StatusWarn || result.Level != "WARN" || result.Message != "dummy" {
+		t.Fatalf("Invalid probe result %v", result)
+	}
+	if len(result.Metrics) != 1 || result.Metrics[0].Value != 26 {
+		t.Fatalf("Invalid metrics %v", result.Metrics)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	if _, _, err := setupProbeTest(""); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	p := New([]string{"test"})
+	if err := p.Persist(map[string]int{"count": 1}); err != nil {
+		t.Fatalf("Unable to persist data : %s", err)
+	}
+
+	// Next run
+	p = New([]string{"test"})
+	if err := p.restore(); err != nil {
+		t.Fatalf("Unable to restore data : %s", err)
+	}
+	data := make(map[string]int)
+	if ok, err := p.Restore(&data); !ok || err != nil {
+		t.Fatalf("Unable to restore data : %s", err)
+	}
+	if data["count"] != 1 {
+		t.Fatalf("Invalid persisted data %v", data)
+	}
+}
+
+func TestPersistAgent(t *testing.T) {
+	output, _, err := setupProbeTest("")
+	if err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	path := tmpProbeConfigDir + "/test.state"
+	if err := ioutil.WriteFile(path, []byte(`{"count":1}`), 0600); err != nil {
+		t.Fatalf("Unable to write state file : %s", err)
+	}
+	os.Setenv("WIGO_PROBE_PERSIST_FILE", path)
+	defer os.Unsetenv("WIGO_PROBE_PERSIST_FILE")
+
+	p := New([]string{"test"})
+	if err := p.restore(); err != nil {
+		t.Fatalf("Unable to restore data : %s", err)
+	}
+	data := make(map[string]int)
+	if ok, _ := p.Restore(&data); !ok || data["count"] != 1 {
+		t.Fatalf("Invalid persisted data %v", data)
+	}
+
+	data["count"]++
+	p.Persist(data)
+	p.Output(0)
+	result, err := executor.NewProbeResultFromJSON(output.Bytes())
+	if err != nil {
+		t.Fatalf("Unable to deserialize probe result : %s", err)
+	}
+	if string(result.Persist) != `{"count":2}` {
+		t.Fatalf("Invalid persisted data %s", result.Persist)
+	}
+}
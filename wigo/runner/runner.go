@@ -1,86 +1,421 @@
-//package runner
-//
-//import (
-//	log "github.com/Sirupsen/logrus"
-//	pathUtil "path"
-//	"strconv"
-//	"sync"
-//)
-//
-//type ProbeRunner struct {
-//	watcher       *ProbeDirectoryWatcher
-//	executors     map[string]*ProbeExecutor
-//	resultChannel chan *ProbeResult
-//	lock          sync.Mutex
-//}
-//
-//func NewProbeRunner(probeDirectory string) (pr *ProbeRunner, err error){
-//	pr = new(ProbeRunner)
-//	pr.resultChannel = make(chan *ProbeResult)
-//	pr.executors = make(map[string]*ProbeExecutor)
-//	pr.watcher, err = NewProbeDirectoryWatcher(probeDirectory, pr)
-//	return
-//}
-//
-//func (pr *ProbeRunner) Results() chan *ProbeResult {
-//	return pr.resultChannel
-//}
-//
-//func (pr *ProbeRunner) AddDirectory(path string, isNew bool) {
-//	log.Infof("Adding probe directory %s", path)
-//}
-//
-//func (pr *ProbeRunner) RemoveDirectory(path string) {
-//	log.Infof("Removing probe directory %s", path)
-//}
-//
-//func (pr *ProbeRunner) AddProbe(path string, isNew bool) {
-//	log.Infof("Adding probe executor for %s", path)
-//
-//	pr.lock.Lock()
-//	defer pr.lock.Unlock()
-//
-//	// Verify directory name
-//	dirname := pathUtil.Base(pathUtil.Dir(path))
-//	timeout, err := strconv.Atoi(dirname)
-//	if err != nil {
-//		if dirname != "examples" {
-//			log.Warnf("Probe directory %s is not numeric. Discarding.", dirname)
-//		}
-//		return
-//	}
-//
-//	if _, ok := pr.executors[path]; ok {
-//		log.Warn("Executor for probe %s already exists", path)
-//		return
-//	}
-//
-//
-//	pe := NewProbeExecutor(path, timeout)
-//	pe.Run(pr.resultChannel)
-//	pr.executors[path] = pe
-//}
-//
-//func (pr *ProbeRunner) RemoveProbe(path string) {
-//	log.Infof("Removing probe executor for %s", path)
-//
-//	pr.lock.Lock()
-//	defer pr.lock.Unlock()
-//
-//	if _, ok := pr.executors[path]; ok {
-//		pr.executors[path].Shutdown()
-//		delete(pr.executors, path)
-//		pr.resultChannel <- NewProbeResult(path, 999, -1, "Probe has been removed", "")
-//		return
-//	}
-//
-//	log.Warn("Executor for probe %s does not exist", path)
-//}
-//
-//func (pr *ProbeRunner) Shutdown() {
-//	pr.watcher.Shutdown()
-//	for _, pe := range pr.executors {
-//		pe.Shutdown()
-//	}
-//	close(pr.resultChannel)
-//}
\ No newline at end of file
+package runner
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/config"
+	"github.com/root-gg/wigo/wigo/executor"
+	"github.com/root-gg/wigo/wigo/utils"
+	"github.com/root-gg/wigo/wigo/watcher"
+	pathUtil "path"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// Name of the result warning that probe directories are polled
+const watcherProbeName = "wigo-watcher"
+
+// ProbeRunner starts a ProbeExecutor for every probe found
+// by the probe directory watcher and for every enabled native
+// probe, and publishes their results.
+type ProbeRunner struct {
+	path          string
+	watcher       *watcher.ProbeDirectoryWatcher
+	configWatcher *watcher.ProbeConfigWatcher
+	executors     map[string]*executor.ProbeExecutor
+	natives       map[string]*executor.ProbeExecutor
+	seen          map[string]bool
+	resultChannel chan *executor.ProbeResult
+	removeChannel chan string
+	lock          sync.Mutex
+}
+
+// NewProbeRunner create a new ProbeRunner instance
+func NewProbeRunner(probeDirectory string) (pr *ProbeRunner, err error) {
+	pr = new(ProbeRunner)
+	pr.path = probeDirectory
+	pr.resultChannel = make(chan *executor.ProbeResult)
+	pr.removeChannel = make(chan string)
+	pr.executors = make(map[string]*executor.ProbeExecutor)
+	pr.natives = make(map[string]*executor.ProbeExecutor)
+	pr.startNativeProbes()
+	pr.watcher, err = watcher.NewProbeDirectoryWatcher(probeDirectory, pr)
+	if err != nil {
+		return
+	}
+
+	configDirectory := executor.GetEnvironment().ConfigRoot
+	if pr.configWatcher, err = watcher.NewProbeConfigWatcher(configDirectory, pr); err != nil {
+		log.Warnf("Unable to watch probe config directory %s, probe configs are not reloaded : %s", configDirectory, err)
+		err = nil
+	}
+	return
+}
+
+// Results return the channel of probe results
+func (pr *ProbeRunner) Results() chan *executor.ProbeResult {
+	return pr.resultChannel
+}
+
+// Removed return the channel of the names of the probes that do not
+// run anymore, prefixed by their team if any like their results
+func (pr *ProbeRunner) Removed() chan string {
+	return pr.removeChannel
+}
+
+func (pr *ProbeRunner) AddDirectory(path string, isNew bool) {
+	log.Infof("Adding probe directory %s", path)
+}
+
+func (pr *ProbeRunner) RemoveDirectory(path string) {
+	log.Infof("Removing probe directory %s", path)
+}
+
+// PollingFallback publish a warning when a probe directory can't
+// be watched, changes are only detected on the next directory scan
+func (pr *ProbeRunner) PollingFallback(path string, err error) {
+	result := executor.NewProbeResult(utils.StatusWarn, -1, fmt.Sprintf("Polling probe directory %s : %s", path, err), "")
+	result.Path = path
+	result.Name = watcherProbeName
+	go func() { pr.resultChannel <- result }()
+}
+
+func (pr *ProbeRunner) AddProbe(path string, isNew bool) {
+	log.Infof("Adding probe executor for %s", path)
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+
+	if old, ok := pr.executors[path]; ok {
+		if pr.seen != nil {
+			pr.seen[path] = true
+			pr.reschedule(path, old)
+			return
+		}
+		log.Warnf("Executor for probe %s already exists", path)
+		return
+	}
+
+	pe := pr.newProbeExecutor(path)
+	if pe == nil {
+		return
+	}
+	if pr.seen != nil {
+		pr.seen[path] = true
+	}
+
+	pr.executors[path] = pe
+	pr.start(pe)
+}
+
+// UpdateProbe restarts the executor of a probe that has been
+// modified, so the new version of the probe and its settings
+// are used from now on
+func (pr *ProbeRunner) UpdateProbe(path string) {
+	log.Infof("Restarting probe executor for %s", path)
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+
+	pr.restart(path)
+}
+
+// restart replace the executor of a probe by a new one
+func (pr *ProbeRunner) restart(path string) {
+	old, ok := pr.executors[path]
+	if !ok {
+		log.Warnf("Executor for probe %s does not exist", path)
+		return
+	}
+
+	pe := pr.newProbeExecutor(path)
+	if pe == nil {
+		delete(pr.executors, path)
+		old.Shutdown()
+		return
+	}
+
+	// Replace the executor before shutting down the old one
+	// so the probe is not reported as removed
+	pr.executors[path] = pe
+	old.Shutdown()
+	pr.start(pe)
+}
+
+// reschedule replace the executor of a probe found again while
+// reloading if its interval or its team changed, or remove it if
+// its interval is not declared anymore
+func (pr *ProbeRunner) reschedule(path string, old *executor.ProbeExecutor) {
+	pe := pr.newProbeExecutor(path)
+	if pe == nil {
+		log.Infof("Removing probe executor for %s", path)
+		delete(pr.executors, path)
+		old.Shutdown()
+		return
+	}
+	if pe.Timeout == old.Timeout && pe.Key == old.Key {
+		return
+	}
+
+	log.Infof("Restarting probe executor for %s, its interval or team changed", path)
+	pr.executors[path] = pe
+	old.Shutdown()
+	pr.start(pe)
+}
+
+// UpdateConfig apply the new config of a probe. The probe is run right
+// away with its new config, daemon probes and native probes are restarted.
+// An invalid config does not trigger a run. Only native probes and probes
+// given their config on stdin keep their last valid config, other probes
+// read the invalid config file themselves on their next run.
+func (pr *ProbeRunner) UpdateConfig(name string) {
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+
+	for path, pe := range pr.executors {
+		if pe.Name != name {
+			continue
+		}
+		if pe.Settings.Daemon {
+			log.Infof("Restarting daemon probe executor for %s", path)
+			pr.restart(path)
+			continue
+		}
+		log.Infof("Reloading probe %s config", path)
+		if err := pe.Reload(); err != nil {
+			log.Warnf("Probe %s config not reloaded : %s", path, err)
+		}
+	}
+
+	for _, native := range executor.NativeProbes() {
+		if native == name {
+			pr.restartNative(name)
+		}
+	}
+}
+
+// UpdateSettings restart the executors of the probes whose
+// settings changed after the configuration has been reloaded
+func (pr *ProbeRunner) UpdateSettings() {
+	if config.GetConfig() == nil {
+		return
+	}
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+
+	for path, pe := range pr.executors {
+		if !reflect.DeepEqual(pe.Settings, config.GetConfig().Probes.Settings(path)) {
+			log.Infof("Restarting probe executor for %s, its settings changed", path)
+			pr.restart(path)
+		}
+	}
+}
+
+// newProbeExecutor create the executor of the probe located at path,
+// nil is returned if the probe can't be run
+func (pr *ProbeRunner) newProbeExecutor(path string) (pe *executor.ProbeExecutor) {
+	// Verify directory name
+	settings := config.NewConfig().Watcher
+	if config.GetConfig() != nil {
+		settings = config.GetConfig().Watcher
+	}
+	dirname := pathUtil.Base(pathUtil.Dir(path))
+	timeout, ok := settings.Interval(dirname)
+	if !ok {
+		if dirname != "examples" {
+			log.Warnf("Probe directory %s is not numeric nor a declared interval. Discarding.", dirname)
+		}
+		return nil
+	}
+
+	pe = executor.NewProbeExecutor(path, timeout)
+	if team := pr.team(path); team != "" {
+		pe.Tags = map[string]string{"team": team}
+		pe.Key = team + "/" + pe.Name
+	}
+	if _, ok := pr.natives[pe.Key]; ok {
+		log.Warnf("Probe %s has the same name as a native probe. Discarding.", path)
+		return nil
+	}
+	return
+}
+
+// team return the path between the probe directory and the interval
+// directory of a probe ( eg : "infra/db" for probes/infra/db/60/dummy.pl )
+func (pr *ProbeRunner) team(path string) string {
+	team, err := filepath.Rel(pr.path, filepath.Dir(filepath.Dir(path)))
+	if err != nil || team == "." {
+		return ""
+	}
+	return team
+}
+
+func (pr *ProbeRunner) RemoveProbe(path string) {
+	log.Infof("Removing probe executor for %s", path)
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+
+	if pe, ok := pr.executors[path]; ok {
+		pe.Shutdown()
+		delete(pr.executors, path)
+		return
+	}
+
+	log.Warnf("Executor for probe %s does not exist", path)
+}
+
+// startNativeProbes starts an executor for every enabled native probe
+func (pr *ProbeRunner) startNativeProbes() {
+	for _, name := range executor.NativeProbes() {
+		pe, err := executor.NewNativeProbeExecutor(name)
+		if err != nil {
+			log.Warnf("Unable to load native probe %s : %s", name, err)
+			continue
+		}
+		if pe == nil {
+			log.Debugf("Native probe %s is not enabled", name)
+			continue
+		}
+
+		log.Infof("Adding native probe executor for %s", name)
+		pr.natives[name] = pe
+		pr.start(pe)
+	}
+}
+
+// restartNative replace the executor of a native probe after its
+// config has changed. The probe is stopped if it is not enabled anymore
+// and started if it has been enabled. An invalid config is not applied.
+func (pr *ProbeRunner) restartNative(name string) {
+	pe, err := executor.NewNativeProbeExecutor(name)
+	if err != nil {
+		log.Warnf("Native probe %s config not reloaded : %s", name, err)
+		return
+	}
+
+	old, ok := pr.natives[name]
+	if pe == nil {
+		if ok {
+			log.Infof("Removing native probe executor for %s", name)
+			delete(pr.natives, name)
+			old.Shutdown()
+		}
+		return
+	}
+
+	log.Infof("Restarting native probe executor for %s", name)
+	pr.natives[name] = pe
+	if ok {
+		old.Shutdown()
+	}
+	pr.start(pe)
+}
+
+// start runs a probe executor and forwards its results
+// until it stops
+func (pr *ProbeRunner) start(pe *executor.ProbeExecutor) {
+	go pe.Run()
+	go func() {
+		for result := range pe.Results {
+			pr.resultChannel <- result
+		}
+		log.Debugf("Probe executor for %s stopped", pe.Name)
+
+		// The executor stops when the probe is removed
+		executors, key := pr.executors, pe.Path
+		if pe.Native != nil {
+			executors, key = pr.natives, pe.Name
+		}
+		pr.lock.Lock()
+		if executors[key] == pe {
+			delete(executors, key)
+		}
+		running := pr.running(pe.Key)
+		pr.lock.Unlock()
+
+		// Restarted and moved executors keep publishing results for the probe
+		if running {
+			return
+		}
+		pr.removeChannel <- pe.Key
+	}()
+}
+
+// running return true if an executor publishes the results of the probe
+func (pr *ProbeRunner) running(key string) bool {
+	if _, ok := pr.natives[key]; ok {
+		return true
+	}
+	for _, pe := range pr.executors {
+		if pe.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload watch a new probe directory and probe config directory. The
+// executors of the probes found in the new probe directory are kept
+// running, the others are removed.
+func (pr *ProbeRunner) Reload(probeDirectory string) (err error) {
+	log.Infof("Reloading probe directory %s", probeDirectory)
+
+	// The watchers call the runner while holding their own lock,
+	// they are shut down without holding the runner lock
+	pr.lock.Lock()
+	oldWatcher, oldConfigWatcher := pr.watcher, pr.configWatcher
+	pr.path = probeDirectory
+	pr.seen = make(map[string]bool)
+	pr.lock.Unlock()
+
+	oldWatcher.Shutdown()
+	if oldConfigWatcher != nil {
+		oldConfigWatcher.Shutdown()
+	}
+
+	// Probes are added while the new directory is scanned
+	w, err := watcher.NewProbeDirectoryWatcher(probeDirectory, pr)
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+
+	pr.watcher = w
+	for path, pe := range pr.executors {
+		if !pr.seen[path] {
+			log.Infof("Removing probe executor for %s", path)
+			delete(pr.executors, path)
+			pe.Shutdown()
+		}
+	}
+	pr.seen = nil
+	if err != nil {
+		return
+	}
+
+	configDirectory := executor.GetEnvironment().ConfigRoot
+	if pr.configWatcher, err = watcher.NewProbeConfigWatcher(configDirectory, pr); err != nil {
+		log.Warnf("Unable to watch probe config directory %s, probe configs are not reloaded : %s", configDirectory, err)
+		err = nil
+	}
+	return
+}
+
+func (pr *ProbeRunner) Shutdown() {
+	pr.watcher.Shutdown()
+	if pr.configWatcher != nil {
+		pr.configWatcher.Shutdown()
+	}
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+
+	for _, pe := range pr.executors {
+		pe.Shutdown()
+	}
+	for _, pe := range pr.natives {
+		pe.Shutdown()
+	}
+}
@@ -1,252 +1,509 @@
-//package runner
-//
-//import (
-//	log "github.com/Sirupsen/logrus"
-//	"os"
-//	"encoding/json"
-//	"io"
-//	"os/exec"
-//	"fmt"
-//	"path/filepath"
-//	"testing"
-//	"time"
-//)
-//
-//const tmpProbeDirectory1 = tmpProbeDirectory + "/1"
-//
-//func setupProbeRunnerTest() (err error) {
-//	// Clean everything
-//	if err = os.RemoveAll(tmpProbeDirectory); err != nil {
-//		log.Errorf("Unable to remove test probe directory %s : %s", tmpProbeDirectory, err)
-//		return
-//	}
-//	if err = os.MkdirAll(tmpProbeDirectory1, 0755); err != nil {
-//		log.Errorf("Unable to create test probe directory %s : %s", tmpProbeDirectory1, err)
-//		return
-//	}
-//	if err = os.RemoveAll(tmpProbeConfigDir); err != nil {
-//		log.Errorf("Unable to remove test probe directory %s : %s", tmpProbeConfigDir, err)
-//		return
-//	}
-//	if err = os.MkdirAll(tmpProbeConfigDir, 0755); err != nil {
-//		log.Errorf("Unable to create test probe directory %s : %s", tmpProbeConfigDir, err)
-//		return
-//	}
-//
-//	// Set config root
-//	os.Setenv("WIGO_PROBE_CONFIG_ROOT", tmpProbeConfigDir)
-//
-//	// Set probe lib root
-//	libRoot, err := filepath.Abs("../../lib")
-//	if err != nil {
-//		log.Errorf("Unable to get lib root : %s", err)
-//		return
-//	}
-//	os.Setenv("WIGO_PROBE_LIB_ROOT", libRoot)
-//	return
-//}
-//
-//func addDummyProbe(probePath string, configPath string, pc *dummyProbeConfig) (err error) {
-//	// Copy dummy probe
-//	cmd := exec.Command("cp", dummyProbePath, probePath)
-//	output, err := cmd.CombinedOutput()
-//	if err != nil {
-//		log.Errorf(string(output))
-//		err = fmt.Errorf("Unable to copy dummy probe from %s to %s : %s", dummyProbePath, probePath, err)
-//		return
-//	}
-//
-//	// Serialize config
-//	json, err := json.Marshal(pc)
-//	if err != nil {
-//		return
-//	}
-//	// Create config file
-//	file, err := os.OpenFile(configPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-//	if err != nil {
-//		return
-//	}
-//	defer file.Close()
-//	_, err = io.WriteString(file, string(json))
-//	if err != nil {
-//		return
-//	}
-//	return
-//}
-//
-//
-//func TestNewProbeRunner(t *testing.T) {
-//	if err := setupProbeRunnerTest(); err != nil {
-//		t.Fatalf("Unable to setup test : %s", err)
-//	}
-//	pr, err := NewProbeRunner(tmpProbeDirectory)
-//	if err != nil {
-//		t.Fatalf("Unable to create new ProbeRunner", err)
-//	}
-//	defer pr.Shutdown()
-//}
-//
-//func TestRunProbe(t *testing.T) {
-//	if err := setupProbeRunnerTest(); err != nil {
-//		t.Fatalf("Unable to setup test : %s", err)
-//	}
-//
-//	// Add dummy probe
-//	pc := newDummyProbeConfig(123)
-//	tmpDummyProbePath := tmpProbeDirectory1 + "/dummy1.pl"
-//	err := addDummyProbe(tmpDummyProbePath, tmpProbeConfigDir + "/dummy1.conf", pc)
-//	if err != nil {
-//		t.Fatalf("Unable to add dummy probe : %s", err)
-//	}
-//
-//	// Create ProbeRunner
-//	pr, err := NewProbeRunner(tmpProbeDirectory)
-//	if err != nil {
-//		t.Fatalf("Unable to create new ProbeRunner", err)
-//	}
-//	defer pr.Shutdown()
-//	if _, ok := pr.executors[tmpDummyProbePath] ; !ok {
-//		t.Fatalf("Missing probe executor for %s", tmpDummyProbePath)
-//	}
-//
-//	// Wait for probe result
-//	select {
-//	case	<- time.After(time.Second):
-//		t.Fatal("Timeout waiting for probe result")
-//	case	result := <- pr.Results():
-//		if result.Status != 123 {
-//			t.Fatal("Invalid probe status %d expected %d", result.Status, 123)
-//		}
-//	}
-//}
-//
-//func TestAddProbeRunner(t *testing.T) {
-//	if err := setupProbeRunnerTest(); err != nil {
-//		t.Fatalf("Unable to setup test : %s", err)
-//	}
-//
-//	// Create ProbeRunner
-//	pr, err := NewProbeRunner(tmpProbeDirectory)
-//	if err != nil {
-//		t.Fatalf("Unable to create new ProbeRunner", err)
-//	}
-//	defer pr.Shutdown()
-//
-//	// Add dummy probe
-//	pc := newDummyProbeConfig(123)
-//	tmpDummyProbePath := tmpProbeDirectory1 + "/dummy1.pl"
-//	err = addDummyProbe(tmpDummyProbePath, tmpProbeConfigDir + "/dummy1.conf", pc)
-//	if err != nil {
-//		t.Fatalf("Unable to add dummy probe : %s", err)
-//	}
-//
-//	// Wait for fsnotify event to be triggered and processed
-//	time.Sleep(time.Duration(100) * time.Millisecond)
-//
-//	if _, ok := pr.executors[tmpDummyProbePath] ; !ok {
-//		t.Fatalf("Missing probe executor for %s", tmpDummyProbePath)
-//	}
-//
-//	// Wait for probe result
-//	select {
-//	case	<- time.After(time.Second):
-//		t.Fatal("Timeout waiting for probe result")
-//	case	result := <- pr.Results():
-//		if result.Status != 123 {
-//			t.Fatal("Invalid probe status %d expected %d", result.Status, 123)
-//		}
-//	}
-//}
-//
-//func TestRemoveProbeRunner(t *testing.T) {
-//	if err := setupProbeRunnerTest(); err != nil {
-//		t.Fatalf("Unable to setup test : %s", err)
-//	}
-//
-//	// Add dummy probe
-//	pc := newDummyProbeConfig(123)
-//	tmpDummyProbePath := tmpProbeDirectory1 + "/dummy1.pl"
-//	err := addDummyProbe(tmpDummyProbePath, tmpProbeConfigDir + "/dummy1.conf", pc)
-//	if err != nil {
-//		t.Fatalf("Unable to add dummy probe : %s", err)
-//	}
-//
-//	// Create ProbeRunner
-//	pr, err := NewProbeRunner(tmpProbeDirectory)
-//	if err != nil {
-//		t.Fatalf("Unable to create new ProbeRunner", err)
-//	}
-//	defer pr.Shutdown()
-//
-//	// Remove dummy probe
-//	err = os.Remove(tmpDummyProbePath)
-//	if err != nil {
-//		t.Fatalf("Unable to remove dummy probe %s : %s", tmpDummyProbePath, err)
-//	}
-//
-//	// Wait for probe result
-//	select {
-//	case	<- time.After(time.Second):
-//		t.Fatal("Timeout waiting for probe result")
-//	case	result := <- pr.Results():
-//		if result.Status != 999 {
-//			t.Fatal("Invalid probe status %d expected %d", result.Status, 999)
-//		}
-//	}
-//
-//	if _, ok := pr.executors[tmpDummyProbePath] ; ok {
-//		t.Fatalf("Probe executor still present for %s", tmpDummyProbePath)
-//	}
-//}
-//
-//func TestRemoveProbeDirectoryRunner(t *testing.T) {
-//	if err := setupProbeRunnerTest(); err != nil {
-//		t.Fatalf("Unable to setup test : %s", err)
-//	}
-//
-//	// Add dummy probe
-//	pc := newDummyProbeConfig(123)
-//	tmpDummyProbePath := tmpProbeDirectory1 + "/dummy1.pl"
-//	err := addDummyProbe(tmpDummyProbePath, tmpProbeConfigDir + "/dummy1.conf", pc)
-//	if err != nil {
-//		t.Fatalf("Unable to add dummy probe : %s", err)
-//	}
-//
-//	// Create ProbeRunner
-//	pr, err := NewProbeRunner(tmpProbeDirectory)
-//	if err != nil {
-//		t.Fatalf("Unable to create new ProbeRunner", err)
-//	}
-//	defer pr.Shutdown()
-//
-//	// Remove dummy probe directory
-//	err = os.RemoveAll(tmpProbeDirectory1)
-//	if err != nil {
-//		t.Fatalf("Unable to remove dummy probe %s : %s", tmpDummyProbePath, err)
-//	}
-//
-//	done := make(chan struct {})
-//	go func(){
-//		for result := range pr.Results() {
-//			log.Infof("%v",result)
-//			if result.Status == 999 {
-//				done <- struct {}{}
-//			}
-//		}
-//	}()
-//
-//	// Wait for probe result
-//	select {
-//	case	<- time.After(time.Second):
-//		t.Fatal("Timeout waiting for probe result")
-//	case	<- done:
-//		break
-//	}
-//
-//	// Wait for fsnotify event to be triggered and processed
-//	time.Sleep(time.Duration(100) * time.Millisecond)
-//
-//	if _, ok := pr.executors[tmpDummyProbePath] ; ok {
-//		t.Fatalf("Probe executor still present for %s", tmpDummyProbePath)
-//	}
-//}
\ No newline at end of file
+package runner
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/config"
+	"github.com/root-gg/wigo/wigo/executor"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const tmpProbeDirectory = "/tmp/wigo_probe_test"
+const tmpProbeDirectory1 = tmpProbeDirectory + "/1"
+const tmpProbeConfigDir = "/tmp/wigo_probe_config_test"
+
+func setupProbeRunnerTest() (err error) {
+	// Clean everything
+	if err = os.RemoveAll(tmpProbeDirectory); err != nil {
+		log.Errorf("Unable to remove test probe directory %s : %s", tmpProbeDirectory, err)
+		return
+	}
+	if err = os.MkdirAll(tmpProbeDirectory1, 0755); err != nil {
+		log.Errorf("Unable to create test probe directory %s : %s", tmpProbeDirectory1, err)
+		return
+	}
+	if err = os.RemoveAll(tmpProbeConfigDir); err != nil {
+		log.Errorf("Unable to remove test probe directory %s : %s", tmpProbeConfigDir, err)
+		return
+	}
+	if err = os.MkdirAll(tmpProbeConfigDir, 0755); err != nil {
+		log.Errorf("Unable to create test probe directory %s : %s", tmpProbeConfigDir, err)
+		return
+	}
+
+	// Set probe environment
+	env := new(executor.ProbeEnvironment)
+	env.ConfigRoot = tmpProbeConfigDir
+	executor.SetEnvironment(env)
+	return
+}
+
+func addDummyProbe(probePath string, status int) (err error) {
+	script := "#!/bin/sh\necho '{\"status\":" + string(rune('0'+status/100)) + "00,\"message\":\"dummy\"}'\n"
+	return ioutil.WriteFile(probePath, []byte(script), 0755)
+}
+
+func waitResult(t *testing.T, pr *ProbeRunner) (result *executor.ProbeResult) {
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for probe result")
+	case result = <-pr.Results():
+	}
+	return
+}
+
+func TestNewProbeRunner(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+}
+
+func TestRunProbe(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	// Add dummy probe
+	tmpDummyProbePath := tmpProbeDirectory1 + "/dummy1.sh"
+	if err := addDummyProbe(tmpDummyProbePath, 300); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+
+	// Create ProbeRunner
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+	if _, ok := pr.executors[tmpDummyProbePath]; !ok {
+		t.Fatalf("Missing probe executor for %s", tmpDummyProbePath)
+	}
+
+	result := waitResult(t, pr)
+	if result.Status != 300 {
+		t.Fatalf("Invalid probe status %d expected %d", result.Status, 300)
+	}
+	if result.Name != "dummy1" {
+		t.Fatalf("Invalid probe name %s expected %s", result.Name, "dummy1")
+	}
+}
+
+func TestRemoveProbeRunner(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	// Add dummy probe
+	tmpDummyProbePath := tmpProbeDirectory1 + "/dummy1.sh"
+	if err := addDummyProbe(tmpDummyProbePath, 100); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+
+	// Create ProbeRunner
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+	waitResult(t, pr)
+
+	// Remove dummy probe
+	if err = os.Remove(tmpDummyProbePath); err != nil {
+		t.Fatalf("Unable to remove dummy probe %s : %s", tmpDummyProbePath, err)
+	}
+
+	// Wait for probe removal
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for probe removal")
+	case name := <-pr.Removed():
+		if name != "dummy1" {
+			t.Fatalf("Invalid removed probe %s expected %s", name, "dummy1")
+		}
+	}
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	if _, ok := pr.executors[tmpDummyProbePath]; ok {
+		t.Fatalf("Probe executor still present for %s", tmpDummyProbePath)
+	}
+}
+
+func TestRunRecursiveProbe(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	if err := config.LoadDefaultConfig(); err != nil {
+		t.Fatalf("Unable to load config : %s", err)
+	}
+	defer config.LoadDefaultConfig()
+	config.GetConfig().Watcher.Recursive = true
+	config.GetConfig().Watcher.Intervals["hourly"] = 3600
+
+	// Add dummy probe in a team directory
+	path := tmpProbeDirectory + "/infra/db/hourly"
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", path, err)
+	}
+	tmpDummyProbePath := path + "/dummy1.sh"
+	if err := addDummyProbe(tmpDummyProbePath, 100); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+
+	// Create ProbeRunner
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+
+	result := waitResult(t, pr)
+	if result.Name != "infra/db/dummy1" {
+		t.Fatalf("Invalid probe name %s expected %s", result.Name, "infra/db/dummy1")
+	}
+	if result.Tags["team"] != "infra/db" {
+		t.Fatalf("Invalid probe team %s expected %s", result.Tags["team"], "infra/db")
+	}
+
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	if pe, ok := pr.executors[tmpDummyProbePath]; !ok || pe.Timeout != 3600 {
+		t.Fatalf("Missing probe executor for %s", tmpDummyProbePath)
+	}
+}
+
+func TestUpdateProbeRunner(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	// Add dummy probe
+	tmpDummyProbePath := tmpProbeDirectory1 + "/dummy1.sh"
+	if err := addDummyProbe(tmpDummyProbePath, 100); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+
+	// Create ProbeRunner
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+	waitResult(t, pr)
+
+	// Deploy a new version of the probe
+	tmpPath := tmpProbeDirectory1 + "/.dummy1.sh.tmp"
+	if err = addDummyProbe(tmpPath, 200); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+	if err = os.Rename(tmpPath, tmpDummyProbePath); err != nil {
+		t.Fatalf("Unable to deploy dummy probe : %s", err)
+	}
+
+	// The restarted executor runs the new version right away
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for probe result")
+	case name := <-pr.Removed():
+		t.Fatalf("Probe %s removed while restarting", name)
+	case result := <-pr.Results():
+		if result.Status != 200 {
+			t.Fatalf("Invalid probe status %d expected %d", result.Status, 200)
+		}
+	}
+}
+
+func TestPollingFallback(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+
+	pr.PollingFallback(tmpProbeDirectory1, fmt.Errorf("nfs file system"))
+	result := waitResult(t, pr)
+	if result.Name != "wigo-watcher" || result.Status != 200 {
+		t.Fatalf("Invalid polling warning %s %d", result.Name, result.Status)
+	}
+}
+
+func TestReloadProbeConfig(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	config.LoadDefaultConfig()
+	config.GetConfig().Watcher.Debounce = 20
+
+	// Add a dummy probe that is not run again before a minute
+	tmpProbeDirectory60 := tmpProbeDirectory + "/60"
+	if err := os.MkdirAll(tmpProbeDirectory60, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", tmpProbeDirectory60, err)
+	}
+	if err := addDummyProbe(tmpProbeDirectory60+"/dummy1.sh", 100); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+	waitResult(t, pr)
+
+	// Disabling the probe pauses it right away
+	configPath := tmpProbeConfigDir + "/dummy1.conf"
+	if err := ioutil.WriteFile(configPath, []byte(`{"enabled":false}`), 0644); err != nil {
+		t.Fatalf("Unable to write probe config %s : %s", configPath, err)
+	}
+	result := waitResult(t, pr)
+	if result.Reason != "disabled" {
+		t.Fatalf("Invalid probe reason %s expected %s", result.Reason, "disabled")
+	}
+
+	// An invalid config is not applied
+	if err := ioutil.WriteFile(configPath, []byte(`{"enabled":`), 0644); err != nil {
+		t.Fatalf("Unable to write probe config %s : %s", configPath, err)
+	}
+	select {
+	case <-time.After(200 * time.Millisecond):
+	case result := <-pr.Results():
+		t.Fatalf("Unexpected probe result %d %s", result.Status, result.Message)
+	}
+
+	// Enabling the probe runs it right away
+	if err := ioutil.WriteFile(configPath, []byte(`{"enabled":true}`), 0644); err != nil {
+		t.Fatalf("Unable to write probe config %s : %s", configPath, err)
+	}
+	result = waitResult(t, pr)
+	if result.Status != 100 || result.Reason == "disabled" {
+		t.Fatalf("Invalid probe result %d %s", result.Status, result.Reason)
+	}
+}
+
+func TestReloadProbeDirectory(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	// Add a probe that is not run again before a minute and a probe
+	// that is not in the new probe directory
+	tmpProbeDirectory60 := tmpProbeDirectory + "/60"
+	if err := os.MkdirAll(tmpProbeDirectory60, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", tmpProbeDirectory60, err)
+	}
+	keptProbePath := tmpProbeDirectory60 + "/dummy1.sh"
+	if err := addDummyProbe(keptProbePath, 100); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+	tmpOtherDirectory := tmpProbeDirectory + "/other/60"
+	if err := os.MkdirAll(tmpOtherDirectory, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", tmpOtherDirectory, err)
+	}
+	if err := addDummyProbe(tmpOtherDirectory+"/dummy2.sh", 100); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+
+	pr, err := NewProbeRunner(tmpProbeDirectory + "/other")
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+	waitResult(t, pr)
+
+	// Same directory, the executors are kept running
+	kept := pr.executors[tmpOtherDirectory+"/dummy2.sh"]
+	if err = pr.Reload(tmpProbeDirectory + "/other"); err != nil {
+		t.Fatalf("Unable to reload probe directory : %s", err)
+	}
+	if pr.executors[tmpOtherDirectory+"/dummy2.sh"] != kept {
+		t.Fatal("Probe executor restarted by a reload of the same probe directory")
+	}
+
+	// New directory, dummy2 is removed and dummy1 is added
+	if err = pr.Reload(tmpProbeDirectory); err != nil {
+		t.Fatalf("Unable to reload probe directory : %s", err)
+	}
+	removed, added := false, false
+	for !removed || !added {
+		select {
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for probe directory reload")
+		case name := <-pr.Removed():
+			if name != "dummy2" {
+				t.Fatalf("Invalid removed probe %s expected %s", name, "dummy2")
+			}
+			removed = true
+		case result := <-pr.Results():
+			if result.Name != "dummy1" {
+				t.Fatalf("Invalid probe name %s expected %s", result.Name, "dummy1")
+			}
+			added = true
+		}
+	}
+}
+
+func TestReloadProbeInterval(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	if err := config.LoadDefaultConfig(); err != nil {
+		t.Fatalf("Unable to load config : %s", err)
+	}
+	defer config.LoadDefaultConfig()
+	config.GetConfig().Watcher.Intervals = map[string]int{"hourly": 3600}
+
+	// Add a probe in a named interval directory
+	tmpProbeDirectoryHourly := tmpProbeDirectory + "/hourly"
+	if err := os.MkdirAll(tmpProbeDirectoryHourly, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", tmpProbeDirectoryHourly, err)
+	}
+	probePath := tmpProbeDirectoryHourly + "/dummy1.sh"
+	if err := addDummyProbe(probePath, 100); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+	waitResult(t, pr)
+
+	// The probe is rescheduled with its new interval
+	config.GetConfig().Watcher.Intervals = map[string]int{"hourly": 1800}
+	if err = pr.Reload(tmpProbeDirectory); err != nil {
+		t.Fatalf("Unable to reload probe directory : %s", err)
+	}
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for probe result")
+	case name := <-pr.Removed():
+		t.Fatalf("Probe %s removed while rescheduling", name)
+	case <-pr.Results():
+	}
+	pr.lock.Lock()
+	timeout := pr.executors[probePath].Timeout
+	pr.lock.Unlock()
+	if timeout != 1800 {
+		t.Fatalf("Invalid probe interval %d, expected %d", timeout, 1800)
+	}
+
+	// The probe is removed once its interval is not declared anymore
+	config.GetConfig().Watcher.Intervals = map[string]int{}
+	if err = pr.Reload(tmpProbeDirectory); err != nil {
+		t.Fatalf("Unable to reload probe directory : %s", err)
+	}
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for probe removal")
+	case name := <-pr.Removed():
+		if name != "dummy1" {
+			t.Fatalf("Invalid removed probe %s expected %s", name, "dummy1")
+		}
+	}
+}
+
+func TestUpdateSettings(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	config.LoadDefaultConfig()
+
+	// Add a dummy probe that is not run again before a minute
+	tmpProbeDirectory60 := tmpProbeDirectory + "/60"
+	if err := os.MkdirAll(tmpProbeDirectory60, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", tmpProbeDirectory60, err)
+	}
+	probePath := tmpProbeDirectory60 + "/dummy1.sh"
+	if err := addDummyProbe(probePath, 100); err != nil {
+		t.Fatalf("Unable to add dummy probe : %s", err)
+	}
+
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+	waitResult(t, pr)
+
+	// Unchanged settings, the executor is kept running
+	kept := pr.executors[probePath]
+	pr.UpdateSettings()
+	if pr.executors[probePath] != kept {
+		t.Fatal("Probe executor restarted while its settings did not change")
+	}
+
+	// The probe is restarted with its new settings
+	config.GetConfig().Probes.Probe = map[string]*config.ProbeSettings{"dummy1": {MaxStdoutSize: 1024}}
+	pr.UpdateSettings()
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for probe result")
+	case name := <-pr.Removed():
+		t.Fatalf("Probe %s removed while restarting", name)
+	case <-pr.Results():
+	}
+	if size := pr.executors[probePath].Settings.MaxStdoutSize; size != 1024 {
+		t.Fatalf("Invalid probe MaxStdoutSize %d, expected %d", size, 1024)
+	}
+}
+
+func TestRunTeamProbesWithSameName(t *testing.T) {
+	if err := setupProbeRunnerTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	if err := config.LoadDefaultConfig(); err != nil {
+		t.Fatalf("Unable to load config : %s", err)
+	}
+	defer config.LoadDefaultConfig()
+	config.GetConfig().Watcher.Recursive = true
+
+	// Add a probe with the same name in two team directories
+	for _, team := range []string{"infra", "db"} {
+		path := tmpProbeDirectory + "/" + team + "/60"
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatalf("Unable to create test probe directory %s : %s", path, err)
+		}
+		if err := addDummyProbe(path+"/check_disk.sh", 100); err != nil {
+			t.Fatalf("Unable to add dummy probe : %s", err)
+		}
+	}
+
+	pr, err := NewProbeRunner(tmpProbeDirectory)
+	if err != nil {
+		t.Fatalf("Unable to create new ProbeRunner : %s", err)
+	}
+	defer pr.Shutdown()
+
+	names := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		names[waitResult(t, pr).Name] = true
+	}
+	if !names["infra/check_disk"] || !names["db/check_disk"] {
+		t.Fatalf("Invalid probe names %v", names)
+	}
+
+	// Removing one of them is reported while the other keeps running
+	if err := os.Remove(tmpProbeDirectory + "/db/60/check_disk.sh"); err != nil {
+		t.Fatalf("Unable to remove dummy probe : %s", err)
+	}
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for probe removal")
+	case name := <-pr.Removed():
+		if name != "db/check_disk" {
+			t.Fatalf("Invalid removed probe %s expected %s", name, "db/check_disk")
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package store is the agent database, a JSON file
+// holding the data persisted by probes between runs.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store is a key value store saved to a file on every change
+type Store struct {
+	path string
+	data map[string]json.RawMessage
+	lock sync.Mutex
+}
+
+// NewStore create a new Store instance and load
+// the existing data from path if any
+func NewStore(path string) (s *Store, err error) {
+	s = new(Store)
+	s.path = path
+	s.data = make(map[string]json.RawMessage)
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("Unable to read database %s : %s", path, err)
+	}
+	if len(bytes) > 0 {
+		if err = json.Unmarshal(bytes, &s.data); err != nil {
+			return nil, fmt.Errorf("Unable to load database %s : %s", path, err)
+		}
+	}
+	return
+}
+
+// Get return the value of a key, nil if the key does not exist
+func (s *Store) Get(key string) (value []byte, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.data[key], nil
+}
+
+// Set the value of a key, which must be valid JSON
+func (s *Store) Set(key string, value []byte) (err error) {
+	if !json.Valid(value) {
+		return fmt.Errorf("Invalid JSON value for key %s", key)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data[key] = json.RawMessage(append([]byte{}, value...))
+	return s.save()
+}
+
+// Delete a key
+func (s *Store) Delete(key string) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.data[key]; !ok {
+		return
+	}
+	delete(s.data, key)
+	return s.save()
+}
+
+// save write the data to a temporary file renamed over the
+// database so it is never left half written
+func (s *Store) save() (err error) {
+	bytes, err := json.Marshal(s.data)
+	if err != nil {
+		return fmt.Errorf("Unable to serialize database : %s", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("Unable to create database directory : %s", err)
+	}
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, bytes, 0600); err != nil {
+		return fmt.Errorf("Unable to write database %s : %s", tmp, err)
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("Unable to write database %s : %s", s.path, err)
+	}
+	return
+}
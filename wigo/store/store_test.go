@@ -0,0 +1,45 @@
+package store
+
+import (
+	"os"
+	"testing"
+)
+
+const tmpDatabase = "/tmp/wigo_store_test/wigo.db"
+
+func TestStore(t *testing.T) {
+	if err := os.RemoveAll("/tmp/wigo_store_test"); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	s, err := NewStore(tmpDatabase)
+	if err != nil {
+		t.Fatalf("Unable to create store : %s", err)
+	}
+	if value, _ := s.Get("foo"); value != nil {
+		t.Fatalf("Invalid value %s for missing key", value)
+	}
+	if err = s.Set("foo", []byte(`{"count":1}`)); err != nil {
+		t.Fatalf("Unable to set value : %s", err)
+	}
+	if err = s.Set("bar", []byte(`{"count":`)); err == nil {
+		t.Fatal("No error while setting invalid JSON value")
+	}
+
+	// Reload from file
+	s, err = NewStore(tmpDatabase)
+	if err != nil {
+		t.Fatalf("Unable to load store : %s", err)
+	}
+	if value, _ := s.Get("foo"); string(value) != `{"count":1}` {
+		t.Fatalf("Invalid value %s, expected %s", value, `{"count":1}`)
+	}
+
+	if err = s.Delete("foo"); err != nil {
+		t.Fatalf("Unable to delete key : %s", err)
+	}
+	s, _ = NewStore(tmpDatabase)
+	if value, _ := s.Get("foo"); value != nil {
+		t.Fatalf("Invalid value %s for deleted key", value)
+	}
+}
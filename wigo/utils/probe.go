@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+)
+
+var configCommentRegexp = regexp.MustCompile(`^([^#;]*)[#;].*$`)
+
+// ReadProbeConfig read a probe JSON configuration file
+func ReadProbeConfig(path string) (config []byte, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return StripConfigComments(data), nil
+}
+
+// StripConfigComments remove comments from a probe configuration.
+// Like the Wigo::Probe perl library anything after a # or a ;
+// on a line is a comment.
+func StripConfigComments(data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = configCommentRegexp.ReplaceAll(line, []byte("$1"))
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// IsProbeConfigDisabled return true if the probe configuration
+// has a top-level "enabled" key set to false
+func IsProbeConfigDisabled(config []byte) bool {
+	var enabled struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.Unmarshal(config, &enabled); err != nil {
+		return false
+	}
+	return enabled.Enabled != nil && !*enabled.Enabled
+}
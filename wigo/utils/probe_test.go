@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"testing"
+)
+
+const commentedProbeConfig = `{
+  # this is a comment
+  "enabled" : false, ; this is another comment
+  "message" : "dummy"
+}`
+
+func TestStripConfigComments(t *testing.T) {
+	expected := "{\n  \n  \"enabled\" : false, \n  \"message\" : \"dummy\"\n}"
+	if config := string(StripConfigComments([]byte(commentedProbeConfig))); config != expected {
+		t.Fatalf("Invalid config %q, expected %q", config, expected)
+	}
+}
+
+func TestIsProbeConfigDisabled(t *testing.T) {
+	if !IsProbeConfigDisabled(StripConfigComments([]byte(commentedProbeConfig))) {
+		t.Fatal("Probe config should be disabled")
+	}
+	for _, config := range []string{`{"enabled":true}`, `{"status":100}`, `[]`, `invalid`} {
+		if IsProbeConfigDisabled([]byte(config)) {
+			t.Fatalf("Probe config %s should not be disabled", config)
+		}
+	}
+}
@@ -1,5 +1,52 @@
 package utils
 
+// Status codes are split in ranges, each range mapping to a level :
+//
+//	100       OK      : everything is fine
+//	101 - 199 INFO    : something worth knowing, but fine
+//	200 - 299 WARN    : the service is degraded
+//	300 - 499 CRIT    : the service is down
+//	500 - 899 ERROR   : the probe failed to check the service ( eg : non zero exit code )
+//	900 - 999 UNKNOWN : the probe is broken, no result could be obtained from it
+//
+// The 900 - 999 range is reserved to wigo. Probes reporting such a status
+// are considered in error.
+const (
+	StatusOk    = 100
+	StatusInfo  = 101
+	StatusWarn  = 200
+	StatusCrit  = 300
+	StatusError = 500
+
+	StatusReserved      = 900
+	StatusDanglingLink  = 990
+	StatusStale         = 991
+	StatusPanic         = 992
+	StatusMemoryLimit   = 993
+	StatusCpuLimit      = 994
+	StatusCannotRun     = 995
+	StatusInvalidResult = 996
+	StatusTimeout       = 997
+	StatusNotExecutable = 998
+	StatusStatFailed    = 999
+)
+
+// StatusReasons describe why wigo produced a status code
+// instead of the probe
+var StatusReasons = map[int]string{
+	StatusError:         "probe_error",
+	StatusDanglingLink:  "dangling_link",
+	StatusStale:         "stale",
+	StatusPanic:         "panic",
+	StatusMemoryLimit:   "memory_limit",
+	StatusCpuLimit:      "cpu_limit",
+	StatusCannotRun:     "cannot_run",
+	StatusInvalidResult: "invalid_result",
+	StatusTimeout:       "timeout",
+	StatusNotExecutable: "not_executable",
+	StatusStatFailed:    "stat_failed",
+}
+
 // StatusCodeToString convert status code to string
 func StatusCodeToString(status int) string {
 	if status == 100 {
@@ -10,8 +57,15 @@ func StatusCodeToString(status int) string {
 		return "WARN"
 	} else if status >= 300 && status < 500 {
 		return "CRIT"
-	} else if status >= 500 {
+	} else if status >= 500 && status < StatusReserved {
 		return "ERROR"
+	} else if IsReservedStatus(status) {
+		return "UNKNOWN"
 	}
 	return "ERROR"
 }
+
+// IsReservedStatus return true if the status code is reserved to wigo
+func IsReservedStatus(status int) bool {
+	return status >= StatusReserved && status < 1000
+}
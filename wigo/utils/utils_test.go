@@ -35,10 +35,29 @@ func TestStatusCodeToString(t *testing.T) {
 			t.Fatalf("Invalid status string %s for status %d, expected %s", level, code, "CRITICAL")
 		}
 	}
-	for code := 500; code < 999; code++ {
+	for code := 500; code < 899; code++ {
 		level = StatusCodeToString(code)
 		if level != "ERROR" {
 			t.Fatalf("Invalid status string %s for status %d, expected %s", level, code, "ERROR")
 		}
 	}
+	for code := 900; code < 999; code++ {
+		level = StatusCodeToString(code)
+		if level != "UNKNOWN" {
+			t.Fatalf("Invalid status string %s for status %d, expected %s", level, code, "UNKNOWN")
+		}
+	}
+}
+
+func TestIsReservedStatus(t *testing.T) {
+	for _, code := range []int{100, 226, 500, 899, 1000} {
+		if IsReservedStatus(code) {
+			t.Fatalf("Status %d should not be reserved", code)
+		}
+	}
+	for code := range StatusReasons {
+		if code != StatusError && !IsReservedStatus(code) {
+			t.Fatalf("Status %d should be reserved", code)
+		}
+	}
 }
@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// debouncer delay the handling of the events of a path until no new
+// event has been received for this path during the delay. This way a
+// file being written is only handled once it is complete.
+type debouncer struct {
+	delay  time.Duration
+	timers map[string]*time.Timer
+	ready  chan string
+	done   chan struct{}
+	lock   sync.Mutex
+}
+
+// newDebouncer create a new debouncer instance
+func newDebouncer(delay time.Duration) (d *debouncer) {
+	d = new(debouncer)
+	d.delay = delay
+	d.timers = make(map[string]*time.Timer)
+	d.ready = make(chan string)
+	d.done = make(chan struct{})
+	return
+}
+
+// event delay the handling of path, the path is sent to
+// the ready channel once its events have settled
+func (d *debouncer) event(path string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if timer, ok := d.timers[path]; ok {
+		timer.Reset(d.delay)
+		return
+	}
+
+	d.timers[path] = time.AfterFunc(d.delay, func() {
+		d.lock.Lock()
+		delete(d.timers, path)
+		d.lock.Unlock()
+
+		select {
+		case d.ready <- path:
+		case <-d.done:
+		}
+	})
+}
+
+// stop discard every pending event
+func (d *debouncer) stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for path, timer := range d.timers {
+		timer.Stop()
+		delete(d.timers, path)
+	}
+	close(d.done)
+}
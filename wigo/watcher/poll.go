@@ -0,0 +1,145 @@
+package watcher
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// File systems on which inotify misses the changes made by other hosts
+var networkFilesystems = map[int64]string{
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+}
+
+// networkFilesystem return the type of the file system of path
+// if changes made on this file system can't be watched
+func networkFilesystem(path string) (fsType string, ok bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return
+	}
+	fsType, ok = networkFilesystems[int64(stat.Type)]
+	return
+}
+
+// watchOrPoll watch a directory using watch, or return true if it must
+// be polled because it is configured so or because fsnotify can't be used
+// ( network file system, no inotify watch left, ... ). The handler is warned
+// when falling back to polling. The caller records that the directory is
+// polled before calling startPolling.
+func (w *ProbeDirectoryWatcher) watchOrPoll(path string, watch func() error) (polling bool, err error) {
+	switch w.settings.Mode {
+	case config.WatcherPolling:
+		log.Infof("Polling probe directory %s every %ds", path, w.settings.PollInterval)
+	case config.WatcherInotify:
+		return false, watch()
+	default:
+		if fsType, ok := networkFilesystem(path); ok {
+			err = fmt.Errorf("%s file system", fsType)
+		} else if err = watch(); err == nil {
+			return false, nil
+		}
+		log.Warnf("Unable to watch probe directory %s, polling it every %ds : %s", path, w.settings.PollInterval, err)
+		w.handler.PollingFallback(path, err)
+	}
+	return true, nil
+}
+
+// startPolling start the poll loop unless it is already running
+func (w *ProbeDirectoryWatcher) startPolling() {
+	w.poller.Do(func() { go w.pollLoop() })
+}
+
+// pollLoop rescan the polled directories until the watcher is shut down
+func (w *ProbeDirectoryWatcher) pollLoop() {
+	interval := w.settings.PollInterval
+	if interval <= 0 {
+		interval = config.NewConfig().Watcher.PollInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll diff the polled directories against the file system and
+// sync every path that appeared or disappeared, or may have changed
+func (w *ProbeDirectoryWatcher) poll() {
+	if w.polling {
+		if _, err := os.Stat(w.path); os.IsNotExist(err) {
+			w.sync(w.path)
+			return
+		}
+		for _, path := range w.pollPaths(w.path, nil) {
+			w.sync(path)
+		}
+	}
+
+	w.lock.Lock()
+	directories := make([]*ProbeDirectory, 0, len(w.directories))
+	for _, pd := range w.directories {
+		if pd.polling {
+			directories = append(directories, pd)
+		}
+	}
+	w.lock.Unlock()
+
+	for _, pd := range directories {
+		for _, path := range w.pollPaths(pd.path, pd.probePaths()) {
+			pd.sync(path)
+		}
+	}
+}
+
+// pollPaths return the paths of a directory to sync : the current
+// entries and the known probes and sub directories. Files modified
+// during the debounce delay are left to the next poll so probes
+// being copied are only handled once complete.
+func (w *ProbeDirectoryWatcher) pollPaths(directory string, probes []string) (paths []string) {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		log.Errorf("Unable to list probe directory %s : %s", directory, err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	debounce := time.Duration(w.settings.Debounce) * time.Millisecond
+	for _, f := range files {
+		path := directory + "/" + f.Name()
+		seen[path] = true
+		if !f.IsDir() && time.Since(f.ModTime()) < debounce {
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	w.lock.Lock()
+	for path := range w.directories {
+		if filepath.Dir(path) == directory {
+			probes = append(probes, path)
+		}
+	}
+	w.lock.Unlock()
+
+	for _, path := range probes {
+		if !seen[path] {
+			paths = append(paths, path)
+		}
+	}
+	return
+}
@@ -0,0 +1,193 @@
+package watcher
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/howeyc/fsnotify"
+	"github.com/root-gg/wigo/wigo/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigHandler is an interface to handle the changes
+// of the probe configuration directory
+type ConfigHandler interface {
+	UpdateConfig(name string)
+}
+
+// ProbeConfigWatcher watchs the probe configuration directory.
+// The handler is given the name of the probe once its <name>.conf
+// file has been created, modified or removed.
+type ProbeConfigWatcher struct {
+	path      string
+	configs   map[string]os.FileInfo
+	watcher   *fsnotify.Watcher
+	handler   ConfigHandler
+	settings  *config.WatcherConfig
+	debouncer *debouncer
+	stop      chan struct{}
+	stopped   sync.Once
+	lock      sync.Mutex
+}
+
+// NewProbeConfigWatcher creates a new ProbeConfigWatcher instance
+func NewProbeConfigWatcher(path string, handler ConfigHandler) (w *ProbeConfigWatcher, err error) {
+	log.Debug("New probe config watcher : " + path)
+
+	w = new(ProbeConfigWatcher)
+	w.path = path
+	w.configs = make(map[string]os.FileInfo)
+	w.handler = handler
+	w.stop = make(chan struct{})
+	w.settings = config.NewConfig().Watcher
+	if config.GetConfig() != nil {
+		w.settings = config.GetConfig().Watcher
+	}
+	w.debouncer = newDebouncer(time.Duration(w.settings.Debounce) * time.Millisecond)
+
+	// Start watcher first to be sure we don't miss any event
+	if w.settings.Mode == config.WatcherPolling {
+		go w.pollLoop()
+	} else if err = w.watch(); err != nil {
+		if w.settings.Mode == config.WatcherInotify {
+			return
+		}
+		log.Warnf("Unable to watch probe config directory %s, polling it every %ds : %s", path, w.settings.PollInterval, err)
+		go w.pollLoop()
+		err = nil
+	}
+
+	// Read directory
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		log.Errorf("Unable to list probe config directory %s : %s", path, err)
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, f := range files {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".conf" {
+			w.configs[w.path+"/"+f.Name()] = f
+		}
+	}
+	return
+}
+
+// watch starts watching the probe config directory
+func (w *ProbeConfigWatcher) watch() (err error) {
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return
+	}
+	if err = w.watcher.Watch(w.path); err != nil {
+		w.watcher.Close()
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case <-w.stop:
+				w.debouncer.stop()
+				w.watcher.Close()
+				return
+			case ev := <-w.watcher.Event:
+				w.debouncer.event(ev.Name)
+			case path := <-w.debouncer.ready:
+				w.sync(path)
+			case err := <-w.watcher.Error:
+				log.Warnf("%s fsnotify watcher error : %s", w.path, err)
+			}
+		}
+	}()
+	return
+}
+
+// pollLoop rescan the probe config directory until the watcher is shut down
+func (w *ProbeConfigWatcher) pollLoop() {
+	interval := w.settings.PollInterval
+	if interval <= 0 {
+		interval = config.NewConfig().Watcher.PollInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			files, err := ioutil.ReadDir(w.path)
+			if err != nil {
+				log.Errorf("Unable to list probe config directory %s : %s", w.path, err)
+				continue
+			}
+			// Files modified during the debounce delay are left to the
+			// next poll so configs being written are only handled once complete
+			paths := make(map[string]bool)
+			debounce := time.Duration(w.settings.Debounce) * time.Millisecond
+			for _, f := range files {
+				paths[w.path+"/"+f.Name()] = time.Since(f.ModTime()) >= debounce
+			}
+			w.lock.Lock()
+			for path := range w.configs {
+				if _, ok := paths[path]; !ok {
+					paths[path] = true
+				}
+			}
+			w.lock.Unlock()
+			for path, settled := range paths {
+				if settled {
+					w.sync(path)
+				}
+			}
+		}
+	}
+}
+
+// sync notify the handler if a probe config file has been
+// created, modified or removed since it was last seen
+func (w *ProbeConfigWatcher) sync(path string) {
+	if filepath.Ext(path) != ".conf" {
+		return
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Error stating %s : %s", path, err)
+		return
+	}
+
+	w.lock.Lock()
+	previous, ok := w.configs[path]
+	switch {
+	case err != nil && !ok:
+		w.lock.Unlock()
+		return
+	case err != nil:
+		delete(w.configs, path)
+	case fileInfo.IsDir():
+		w.lock.Unlock()
+		return
+	case ok && !changed(previous, fileInfo):
+		w.lock.Unlock()
+		return
+	default:
+		w.configs[path] = fileInfo
+	}
+	w.lock.Unlock()
+
+	name := strings.TrimSuffix(filepath.Base(path), ".conf")
+	log.Infof("Probe %s config has changed", name)
+	w.handler.UpdateConfig(name)
+}
+
+// Shutdown stops watching the probe config directory
+func (w *ProbeConfigWatcher) Shutdown() (err error) {
+	log.Debug("Shutdown probe config watcher : " + w.path)
+	w.stopped.Do(func() { close(w.stop) })
+	return
+}
@@ -0,0 +1,120 @@
+package watcher
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"os"
+	"path/filepath"
+)
+
+// probeFile is a probe registered in a probe directory. Probes may be
+// symlinks to a shared library directory, they are resolved so the
+// changes of their target are detected.
+type probeFile struct {
+	info   os.FileInfo
+	target string
+
+	// Target of a dangling symlink
+	missing string
+}
+
+// dangling return true if the probe is a symlink to nothing
+func (pf *probeFile) dangling() bool {
+	return pf.target == ""
+}
+
+// resolve return the file info of a probe and the path it resolves to.
+// A dangling symlink is returned with the info of the link itself and
+// the path of its missing target.
+func resolve(path string) (pf *probeFile, err error) {
+	pf = new(probeFile)
+	if pf.info, err = os.Stat(path); err == nil {
+		pf.target, err = filepath.EvalSymlinks(path)
+		return
+	}
+
+	info, lerr := os.Lstat(path)
+	if lerr != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil, err
+	}
+	pf.info = info
+	if pf.missing, err = os.Readlink(path); err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(pf.missing) {
+		pf.missing = filepath.Join(filepath.Dir(path), pf.missing)
+	}
+	return pf, nil
+}
+
+// claim register path as the probe of target, false is returned if
+// another probe resolving to the same target is already registered
+func (w *ProbeDirectoryWatcher) claim(target string, path string) (owner string, ok bool) {
+	w.targetLock.Lock()
+	defer w.targetLock.Unlock()
+
+	if owner, ok = w.targets[target]; ok && owner != path {
+		return owner, false
+	}
+	w.targets[target] = path
+	return path, true
+}
+
+// release the target of a probe
+func (w *ProbeDirectoryWatcher) release(target string, path string) {
+	w.targetLock.Lock()
+	defer w.targetLock.Unlock()
+
+	if w.targets[target] == path {
+		delete(w.targets, target)
+	}
+}
+
+// watchTarget watch the target of a symlinked probe located outside
+// the probe directory, its events are handled as events of the link.
+// The directory of the target of a dangling symlink is watched so the
+// probe is updated once its target is created.
+func (pd *ProbeDirectory) watchTarget(path string, pf *probeFile) {
+	target, watch := pf.target, pf.target
+	if pf.dangling() {
+		target, watch = pf.missing, filepath.Dir(pf.missing)
+	}
+	if pd.watcher == nil || filepath.Dir(target) == pd.path {
+		return
+	}
+
+	if pd.watches[watch] == 0 {
+		if err := pd.watcher.Watch(watch); err != nil {
+			log.Warnf("Unable to watch target %s of probe %s : %s", target, path, err)
+			return
+		}
+	}
+	pd.watches[watch]++
+	pd.links[target] = path
+}
+
+// unwatchTarget stop watching the target of a symlinked probe
+func (pd *ProbeDirectory) unwatchTarget(path string, pf *probeFile) {
+	target, watch := pf.target, pf.target
+	if pf.dangling() {
+		target, watch = pf.missing, filepath.Dir(pf.missing)
+	}
+	if pd.links[target] != path {
+		return
+	}
+	delete(pd.links, target)
+
+	// The watch is already gone if the target has been removed
+	if pd.watches[watch]--; pd.watches[watch] <= 0 {
+		delete(pd.watches, watch)
+		pd.watcher.RemoveWatch(watch)
+	}
+}
+
+// link return the probe linking to target if any
+func (pd *ProbeDirectory) link(target string) (path string, ok bool) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
+	path, ok = pd.links[target]
+	return
+}
@@ -3,10 +3,13 @@ package watcher
 import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/howeyc/fsnotify"
+	"github.com/root-gg/wigo/wigo/config"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
-	"github.com/root-gg/wigo/wigo/global"
+	"time"
 )
 
 // EventHandler is an interface to handle events from
@@ -15,7 +18,9 @@ type EventHandler interface {
 	AddDirectory(path string, isNew bool)
 	RemoveDirectory(path string)
 	AddProbe(ProbeConfig string, isNew bool)
+	UpdateProbe(ProbeConfig string)
 	RemoveProbe(ProbeConfig string)
+	PollingFallback(path string, err error)
 }
 
 // ProbeDirectoryWatcher watchs for probe directories.
@@ -23,12 +28,21 @@ type EventHandler interface {
 // be named by a number specifying the delay in seconds between
 // two executions of the probes that it contains. Other files or
 // directories will not be added ( eg : the examples folder ).
+// In recursive mode directories are watched at any depth so
+// probes can be organised as probes/<team>/<interval>/.
 type ProbeDirectoryWatcher struct {
 	path        string
 	directories map[string]*ProbeDirectory
 	watcher     *fsnotify.Watcher
 	handler     EventHandler
+	settings    *config.WatcherConfig
+	debouncer   *debouncer
+	targets     map[string]string
+	targetLock  sync.Mutex
+	polling     bool
+	poller      sync.Once
 	stop        chan struct{}
+	stopped     sync.Once
 	lock        sync.Mutex
 }
 
@@ -38,9 +52,15 @@ func NewProbeDirectoryWatcher(path string, handler EventHandler) (w *ProbeDirect
 
 	w = new(ProbeDirectoryWatcher)
 	w.directories = make(map[string]*ProbeDirectory)
+	w.targets = make(map[string]string)
 	w.handler = handler
 	w.stop = make(chan struct{})
 	w.path = path
+	w.settings = config.NewConfig().Watcher
+	if config.GetConfig() != nil {
+		w.settings = config.GetConfig().Watcher
+	}
+	w.debouncer = newDebouncer(time.Duration(w.settings.Debounce) * time.Millisecond)
 
 	// Check if the probe directory exist
 	src, err := os.Stat(w.path)
@@ -56,9 +76,12 @@ func NewProbeDirectoryWatcher(path string, handler EventHandler) (w *ProbeDirect
 	}
 
 	// Start watcher first to be sure we don't miss any event
-	if err = w.watch(); err != nil {
+	if w.polling, err = w.watchOrPoll(w.path, w.watch); err != nil {
 		return
 	}
+	if w.polling {
+		w.startPolling()
+	}
 
 	// Read directory
 	files, err := ioutil.ReadDir(path)
@@ -89,6 +112,7 @@ func (w *ProbeDirectoryWatcher) watch() (err error) {
 	err = w.watcher.Watch(w.path)
 	if err != nil {
 		log.Errorf("Unable to create fsnotify watcher on %s : %s", w.path, err)
+		w.watcher.Close()
 		return
 	}
 
@@ -99,25 +123,15 @@ func (w *ProbeDirectoryWatcher) watch() (err error) {
 			select {
 			case <-w.stop:
 				// Shutdown gracefully
+				w.debouncer.stop()
 				w.watcher.Close()
 				break loop
 			case ev := <-w.watcher.Event:
-				if ev.IsCreate() {
-					fileInfo, err := os.Stat(ev.Name)
-					if err != nil {
-						log.Errorf("Error stating %s : %s", ev.Name, err)
-						continue
-					}
-					if fileInfo.IsDir() {
-						w.addDirectory(ev.Name, true)
-					}
-				} else if ev.IsDelete() {
-					w.removeDirectory(ev.Name)
-				} else if ev.IsRename() {
-					w.removeDirectory(ev.Name)
-				}
+				w.debouncer.event(ev.Name)
+			case path := <-w.debouncer.ready:
+				w.sync(path)
 			case err := <-w.watcher.Error:
-				log.Warn("%s fsnotify watcher error : %s", w.path, err)
+				log.Warnf("%s fsnotify watcher error : %s", w.path, err)
 			}
 
 		}
@@ -126,11 +140,35 @@ func (w *ProbeDirectoryWatcher) watch() (err error) {
 	return
 }
 
+// sync add or remove a probe directory once the events of
+// its path have settled, depending on what is on the file system
+func (w *ProbeDirectoryWatcher) sync(path string) {
+	fileInfo, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Error stating %s : %s", path, err)
+		return
+	}
+
+	if err == nil && fileInfo.IsDir() {
+		if path != w.path && !w.isDirectory(path) {
+			w.addDirectory(path, true)
+		}
+		return
+	}
+	if path == w.path || w.isDirectory(path) {
+		w.removeDirectory(path)
+	}
+}
+
 // Shutdown gracefully and recursively stops all directory watchers
 // and probe runners
 func (w *ProbeDirectoryWatcher) Shutdown() (err error) {
 	log.Debug("Shutdown probe directory watcher : " + w.path)
-	w.stop <- struct{}{}
+	w.stopped.Do(func() { close(w.stop) })
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
 	for _, pd := range w.directories {
 		pd.shutdown()
 	}
@@ -140,19 +178,34 @@ func (w *ProbeDirectoryWatcher) Shutdown() (err error) {
 // Add a new probe directory to watch
 func (w *ProbeDirectoryWatcher) addDirectory(path string, isNew bool) (err error) {
 	// Check if directory exists
-	if _, ok := w.directories[path]; ok {
-		log.Warn("Probe directory %s has already been added. Discarding", path)
+	w.lock.Lock()
+	_, ok := w.directories[path]
+	w.lock.Unlock()
+	if ok {
+		log.Warnf("Probe directory %s has already been added. Discarding", path)
 		return
 	}
 
-	// Create ProbeDirectory
-	pd, err := newProbeDirectory(path, w.handler)
+	// Create ProbeDirectory, sub directories are added
+	// while it is scanned in recursive mode
+	pd, err := newProbeDirectory(path, w)
 	if err != nil {
 		return
 	}
+	w.lock.Lock()
 	w.directories[path] = pd
+	w.lock.Unlock()
 	w.handler.AddDirectory(path, isNew)
-	return
+	return pd.scan(isNew)
+}
+
+// isDirectory return true if path is a watched probe directory
+func (w *ProbeDirectoryWatcher) isDirectory(path string) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	_, ok := w.directories[path]
+	return ok
 }
 
 // RemoveDirectory removes a probe directory from the watcher.
@@ -160,7 +213,7 @@ func (w *ProbeDirectoryWatcher) addDirectory(path string, isNew bool) (err error
 func (w *ProbeDirectoryWatcher) removeDirectory(path string) {
 	log.Debug("Remove probe directory : " + path)
 	if path == w.path {
-		log.Warn("Probe directory %s has been removed. Shutting down probe watcher", w.path)
+		log.Warnf("Probe directory %s has been removed. Shutting down probe watcher", w.path)
 		w.Shutdown()
 		return
 	}
@@ -169,17 +222,23 @@ func (w *ProbeDirectoryWatcher) removeDirectory(path string) {
 	defer w.lock.Unlock()
 
 	// Check if directory exists
-	if pd, ok := w.directories[path]; ok {
+	if _, ok := w.directories[path]; !ok {
+		log.Warnf("Probe directory %s is not present. Discarding", path)
+		return
+	}
+
+	// Sub directories are removed first in recursive mode
+	for subPath, pd := range w.directories {
+		if subPath != path && !strings.HasPrefix(subPath, path+"/") {
+			continue
+		}
 		pd.shutdown()
-		for probePath := range pd.probes {
+		for _, probePath := range pd.probePaths() {
 			pd.removeProbe(probePath)
 		}
-		delete(w.directories, path)
-		w.handler.RemoveDirectory(path)
-		return
+		delete(w.directories, subPath)
+		w.handler.RemoveDirectory(subPath)
 	}
-
-	log.Warnf("Probe directory %s is not present. Discarding", path)
 	return
 }
 
@@ -189,19 +248,29 @@ type ProbeDirectory struct {
 	path    string
 	watcher *fsnotify.Watcher
 	handler EventHandler
-	probes  map[string]bool
-	stop    chan struct{}
-	lock    sync.Mutex
+	parent    *ProbeDirectoryWatcher
+	probes    map[string]*probeFile
+	links     map[string]string
+	watches   map[string]int
+	debouncer *debouncer
+	polling   bool
+	stop      chan struct{}
+	stopped   sync.Once
+	lock      sync.Mutex
 }
 
 // NewProbeDirectory create a new ProbeDirectory instance
-func newProbeDirectory(path string, handler EventHandler) (pd *ProbeDirectory, err error) {
+func newProbeDirectory(path string, parent *ProbeDirectoryWatcher) (pd *ProbeDirectory, err error) {
 	log.Debug("New probe directory : " + path)
 
 	pd = new(ProbeDirectory)
 	pd.path = path
-	pd.handler = handler
-	pd.probes = make(map[string]bool)
+	pd.parent = parent
+	pd.handler = parent.handler
+	pd.probes = make(map[string]*probeFile)
+	pd.links = make(map[string]string)
+	pd.watches = make(map[string]int)
+	pd.debouncer = newDebouncer(time.Duration(parent.settings.Debounce) * time.Millisecond)
 	pd.stop = make(chan struct{})
 
 	// check if the probe directory exist
@@ -217,21 +286,26 @@ func newProbeDirectory(path string, handler EventHandler) (pd *ProbeDirectory, e
 		return
 	}
 
-	if err = pd.watch(); err != nil {
-		return
+	if pd.polling, err = parent.watchOrPoll(pd.path, pd.watch); err == nil && pd.polling {
+		parent.startPolling()
 	}
+	return
+}
 
-	// Read directory
-	files, err := ioutil.ReadDir(path)
+// scan add the probes of the directory, and its sub
+// directories in recursive mode
+func (pd *ProbeDirectory) scan(isNew bool) (err error) {
+	files, err := ioutil.ReadDir(pd.path)
 	if err != nil {
-		log.Errorf("Unable to list probe directory %s : %s", path, err)
+		log.Errorf("Unable to list probe directory %s : %s", pd.path, err)
 		return
 	}
 
-	// Keep only files
 	for _, f := range files {
 		if !f.IsDir() {
-			pd.addProbe(pd.path+"/"+f.Name(), false)
+			pd.addProbe(pd.path+"/"+f.Name(), isNew)
+		} else if pd.parent.settings.Recursive {
+			pd.parent.addDirectory(pd.path+"/"+f.Name(), isNew)
 		}
 	}
 
@@ -251,6 +325,7 @@ func (pd *ProbeDirectory) watch() (err error) {
 	err = pd.watcher.Watch(pd.path)
 	if err != nil {
 		log.Errorf("Unable to create fsnotify watcher on %s : %s", pd.path, err)
+		pd.watcher.Close()
 		return
 	}
 
@@ -261,25 +336,20 @@ func (pd *ProbeDirectory) watch() (err error) {
 			select {
 			case <-pd.stop:
 				// Graceful shutdown
+				pd.debouncer.stop()
 				pd.watcher.Close()
 				break loop
 			case ev := <-pd.watcher.Event:
-				if ev.IsCreate() {
-					fileInfo, err := os.Stat(ev.Name)
-					if err != nil {
-						log.Errorf("Error stating %s : %s", ev.Name, err)
-						continue
-					}
-					if !fileInfo.IsDir() {
-						pd.addProbe(ev.Name, true)
-					}
-				} else if ev.IsDelete() {
-					pd.removeProbe(ev.Name)
-				} else if ev.IsRename() {
-					pd.removeProbe(ev.Name)
+				// Events of the directory itself are handled by the parent
+				if path, ok := pd.link(ev.Name); ok {
+					pd.debouncer.event(path)
+				} else if ev.Name != pd.path && filepath.Dir(ev.Name) == pd.path {
+					pd.debouncer.event(ev.Name)
 				}
+			case path := <-pd.debouncer.ready:
+				pd.sync(path)
 			case err := <-pd.watcher.Error:
-				log.Warn("%s fsnotify watcher error : %s", pd.path, err)
+				log.Warnf("%s fsnotify watcher error : %s", pd.path, err)
 			}
 
 		}
@@ -288,18 +358,139 @@ func (pd *ProbeDirectory) watch() (err error) {
 	return
 }
 
+// sync add, update or remove a probe once the events of its path
+// have settled. Handling the final state of the path instead of every
+// event means a probe being copied is only added once complete, and a
+// probe renamed into place over an existing one ( atomic deploy ) is
+// updated instead of removed and added again.
+func (pd *ProbeDirectory) sync(path string) {
+	pf, err := resolve(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Error stating %s : %s", path, err)
+		return
+	}
+
+	if pd.parent.isDirectory(path) {
+		if err != nil || !pf.info.IsDir() {
+			pd.parent.removeDirectory(path)
+		}
+		return
+	}
+	if err == nil && pf.info.IsDir() {
+		if pd.parent.settings.Recursive {
+			pd.parent.addDirectory(path, true)
+		}
+		return
+	}
+
+	pd.lock.Lock()
+	previous, ok := pd.probes[path]
+	pd.lock.Unlock()
+
+	switch {
+	case err != nil && ok:
+		pd.removeProbe(path)
+	case err != nil:
+		// Temporary file removed before its events settled
+	case !ok:
+		pd.addProbe(path, true)
+	case modified(previous, pf):
+		pd.updateProbe(path, pf)
+	}
+}
+
+// modified return true if a probe file has been replaced, modified
+// or if the symlink of the probe now points to another file
+func modified(previous *probeFile, current *probeFile) bool {
+	return previous.target != current.target || changed(previous.info, current.info)
+}
+
+// changed return true if a file has been replaced or modified
+func changed(previous os.FileInfo, current os.FileInfo) bool {
+	return !os.SameFile(previous, current) ||
+		!previous.ModTime().Equal(current.ModTime()) ||
+		previous.Size() != current.Size() ||
+		previous.Mode() != current.Mode()
+}
+
+// probePaths return the paths of the probes of the directory
+func (pd *ProbeDirectory) probePaths() (paths []string) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
+	for path := range pd.probes {
+		paths = append(paths, path)
+	}
+	return
+}
+
 // Add a new probe to the probe list
 func (pd *ProbeDirectory) addProbe(path string, isNew bool) (err error) {
+	// Skip editor temporary files, backups and disabled probes
+	if !pd.parent.settings.Accept(filepath.Base(path)) {
+		log.Debugf("Ignoring probe %s", path)
+		return
+	}
+
+	pf, err := resolve(path)
+	if err != nil {
+		log.Errorf("Error stating %s : %s", path, err)
+		return
+	}
+
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
 	// Check if probe exists
 	if _, ok := pd.probes[path]; ok {
-		log.Warn("Probe %s has already been added. Discarding", path)
+		log.Warnf("Probe %s has already been added. Discarding", path)
 		return
 	}
-	pd.probes[path] = true
+
+	// Dangling symlinks are added so the executor reports them
+	if pf.dangling() {
+		log.Warnf("Probe %s is a dangling symlink", path)
+	} else if owner, ok := pd.parent.claim(pf.target, path); !ok {
+		log.Warnf("Probe %s and probe %s are the same file %s. Discarding", path, owner, pf.target)
+		return
+	}
+
+	pd.probes[path] = pf
+	pd.watchTarget(path, pf)
 	pd.handler.AddProbe(path, isNew)
 	return
 }
 
+// updateProbe restart a probe modified in place, replaced
+// or whose symlink target changed
+func (pd *ProbeDirectory) updateProbe(path string, pf *probeFile) {
+	log.Infof("Probe %s has been modified", path)
+
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
+	previous := pd.probes[path]
+	pd.unwatchTarget(path, previous)
+	if previous.target != pf.target {
+		pd.parent.release(previous.target, path)
+		if !pf.dangling() {
+			if owner, ok := pd.parent.claim(pf.target, path); !ok {
+				log.Warnf("Probe %s and probe %s are the same file %s. Removing", path, owner, pf.target)
+				delete(pd.probes, path)
+				pd.handler.RemoveProbe(path)
+				return
+			}
+		}
+	}
+	if pf.dangling() {
+		log.Warnf("Probe %s is a dangling symlink", path)
+	}
+
+	pd.probes[path] = pf
+	pd.watchTarget(path, pf)
+	pd.handler.UpdateProbe(path)
+}
+
 // Add a new probe to the probe list
 func (pd *ProbeDirectory) removeProbe(path string) (err error) {
 	if path == pd.path {
@@ -311,7 +502,9 @@ func (pd *ProbeDirectory) removeProbe(path string) (err error) {
 	defer pd.lock.Unlock()
 
 	// Check if probe exists
-	if _, ok := pd.probes[path]; ok {
+	if pf, ok := pd.probes[path]; ok {
+		pd.unwatchTarget(path, pf)
+		pd.parent.release(pf.target, path)
 		delete(pd.probes, path)
 		pd.handler.RemoveProbe(path)
 		return
@@ -325,6 +518,6 @@ func (pd *ProbeDirectory) removeProbe(path string) (err error) {
 // and probe runners.
 func (pd *ProbeDirectory) shutdown() (err error) {
 	log.Debug("Shutdown probe directory : " + pd.path)
-	pd.stop <- struct{}{}
+	pd.stopped.Do(func() { close(pd.stop) })
 	return
 }
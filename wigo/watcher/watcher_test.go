@@ -2,16 +2,27 @@ package watcher
 
 import (
 	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/config"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"sync"
 	"testing"
 	"time"
 )
 
 const tmpProbeDirectory = "/tmp/wigo_probe_test"
+const tmpProbeLibDirectory = "/tmp/wigo_probe_lib_test"
+const tmpProbeConfigDirectory = "/tmp/wigo_probe_config_test"
 
 func setupWatcherTest() (err error) {
 	//	log.SetLevel(log.DebugLevel)
+	if err = config.LoadDefaultConfig(); err != nil {
+		log.Errorf("Unable to load config : %s", err)
+		return
+	}
+	config.GetConfig().Watcher.Debounce = 20
+
 	if err = os.RemoveAll(tmpProbeDirectory); err != nil {
 		log.Errorf("Unable to remove test probe directory %s : %s", tmpProbeDirectory, err)
 		return
@@ -26,6 +37,10 @@ func setupWatcherTest() (err error) {
 type TestEventHandler struct {
 	directories []string
 	probes      []string
+	updates     []string
+	fallbacks   []string
+	configs     []string
+	lock        sync.Mutex
 }
 
 func NewTestEventHandler() (eh *TestEventHandler) {
@@ -36,11 +51,17 @@ func NewTestEventHandler() (eh *TestEventHandler) {
 }
 
 func (eh *TestEventHandler) AddDirectory(path string, isNew bool) {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+
 	log.Debugf("Add directory %s ( isNew : %t )", path, isNew)
 	eh.directories = append(eh.directories, path)
 }
 
 func (eh *TestEventHandler) RemoveDirectory(path string) {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+
 	log.Debugf("Remove directory %s", path)
 	for i := 0; i < len(eh.directories); i++ {
 		if eh.directories[i] == path {
@@ -51,11 +72,41 @@ func (eh *TestEventHandler) RemoveDirectory(path string) {
 }
 
 func (eh *TestEventHandler) AddProbe(path string, isNew bool) {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+
 	log.Debugf("Add probe %s ( isNew : %t )", path, isNew)
 	eh.probes = append(eh.probes, path)
 }
 
+func (eh *TestEventHandler) UpdateProbe(path string) {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+
+	log.Debugf("Update probe %s", path)
+	eh.updates = append(eh.updates, path)
+}
+
+func (eh *TestEventHandler) PollingFallback(path string, err error) {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+
+	log.Debugf("Polling directory %s : %s", path, err)
+	eh.fallbacks = append(eh.fallbacks, path)
+}
+
+func (eh *TestEventHandler) UpdateConfig(name string) {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+
+	log.Debugf("Update probe config %s", name)
+	eh.configs = append(eh.configs, name)
+}
+
 func (eh *TestEventHandler) RemoveProbe(path string) {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+
 	log.Debugf("Remove probe %s", path)
 	for i := 0; i < len(eh.probes); i++ {
 		if eh.probes[i] == path {
@@ -65,6 +116,62 @@ func (eh *TestEventHandler) RemoveProbe(path string) {
 	}
 }
 
+// Directories, Probes, Updates, Fallbacks and Configs return a copy of
+// the events received so far, they are called while watchers are running
+
+func (eh *TestEventHandler) Directories() []string {
+	return eh.copy(&eh.directories)
+}
+
+func (eh *TestEventHandler) Probes() []string {
+	return eh.copy(&eh.probes)
+}
+
+func (eh *TestEventHandler) Updates() []string {
+	return eh.copy(&eh.updates)
+}
+
+func (eh *TestEventHandler) Fallbacks() []string {
+	return eh.copy(&eh.fallbacks)
+}
+
+func (eh *TestEventHandler) Configs() []string {
+	return eh.copy(&eh.configs)
+}
+
+func (eh *TestEventHandler) copy(events *[]string) []string {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+
+	return append([]string{}, *events...)
+}
+
+// directoryCount, watchedDirectory and watchedProbe
+// read the state of a running watcher
+
+func directoryCount(w *ProbeDirectoryWatcher) int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return len(w.directories)
+}
+
+func watchedDirectory(w *ProbeDirectoryWatcher, path string) *ProbeDirectory {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.directories[path]
+}
+
+func watchedProbe(w *ProbeDirectoryWatcher, directory string, path string) (pf *probeFile, ok bool) {
+	pd := watchedDirectory(w, directory)
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
+	pf, ok = pd.probes[path]
+	return
+}
+
 func TestNewProbeDirectoryWatcher(t *testing.T) {
 	if err := setupWatcherTest(); err != nil {
 		t.Fatalf("Unable to setup test : %s", err)
@@ -83,20 +190,20 @@ func TestNewProbeDirectoryWatcher(t *testing.T) {
 	}
 	defer w.Shutdown()
 
-	if len(w.directories) != 1 {
-		t.Fatalf("Invalid probe directory count : %d, expected %d", len(w.directories), 1)
+	if directoryCount(w) != 1 {
+		t.Fatalf("Invalid probe directory count : %d, expected %d", directoryCount(w), 1)
 	}
 
-	if w.directories[path].path != path {
-		t.Fatalf("Invalid directory path %s, expected %s", w.directories[path].path, path)
+	if watchedDirectory(w, path).path != path {
+		t.Fatalf("Invalid directory path %s, expected %s", watchedDirectory(w, path).path, path)
 	}
 
-	if len(eh.directories) != 1 {
-		t.Fatalf("Invalid handler probe directory count: %d, expected %d", len(eh.directories), 1)
+	if len(eh.Directories()) != 1 {
+		t.Fatalf("Invalid handler probe directory count: %d, expected %d", len(eh.Directories()), 1)
 	}
 
-	if eh.directories[0] != path {
-		t.Fatalf("Invalid handler directory path %s, expected %s", eh.directories[0], path)
+	if eh.Directories()[0] != path {
+		t.Fatalf("Invalid handler directory path %s, expected %s", eh.Directories()[0], path)
 	}
 
 }
@@ -122,20 +229,20 @@ func TestAddProbeDirectory(t *testing.T) {
 	// Wait for fsnotify event to be triggered and processed
 	time.Sleep(time.Duration(100) * time.Millisecond)
 
-	if len(w.directories) != 1 {
-		t.Fatalf("Invalid probe directory count : %d, expected %d", len(w.directories), 1)
+	if directoryCount(w) != 1 {
+		t.Fatalf("Invalid probe directory count : %d, expected %d", directoryCount(w), 1)
 	}
 
-	if w.directories[path].path != path {
-		t.Fatalf("Invalid directory path %s, expected %s", w.directories[path].path, path)
+	if watchedDirectory(w, path).path != path {
+		t.Fatalf("Invalid directory path %s, expected %s", watchedDirectory(w, path).path, path)
 	}
 
-	if len(eh.directories) != 1 {
-		t.Fatalf("Invalid handler probe directory count: %d, expected %d", len(eh.directories), 1)
+	if len(eh.Directories()) != 1 {
+		t.Fatalf("Invalid handler probe directory count: %d, expected %d", len(eh.Directories()), 1)
 	}
 
-	if eh.directories[0] != path {
-		t.Fatalf("Invalid handler directory path %s, expected %s", eh.directories[0], path)
+	if eh.Directories()[0] != path {
+		t.Fatalf("Invalid handler directory path %s, expected %s", eh.Directories()[0], path)
 	}
 }
 
@@ -166,12 +273,12 @@ func TestRemoveProbeDirectory(t *testing.T) {
 	// Wait for fsnotify event to be triggered and processed
 	time.Sleep(time.Duration(100) * time.Millisecond)
 
-	if len(w.directories) != 0 {
-		t.Fatalf("Invalid watcher directory count : %d, expected %d", len(w.directories), 0)
+	if directoryCount(w) != 0 {
+		t.Fatalf("Invalid watcher directory count : %d, expected %d", directoryCount(w), 0)
 	}
 
-	if len(eh.directories) != 0 {
-		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.directories), 0)
+	if len(eh.Directories()) != 0 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 0)
 	}
 }
 
@@ -201,23 +308,23 @@ func TestNewProbeDirectoryWatcherWithProbe(t *testing.T) {
 	}
 	defer w.Shutdown()
 
-	if len(eh.directories) != 1 {
-		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.directories), 1)
+	if len(eh.Directories()) != 1 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 1)
 	}
 
-	if eh.directories[0] != path {
-		t.Fatalf("Invalid handler directory path %s, expected %s", eh.directories[0], path)
+	if eh.Directories()[0] != path {
+		t.Fatalf("Invalid handler directory path %s, expected %s", eh.Directories()[0], path)
 	}
 
-	if len(eh.probes) != 1 {
-		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.probes), 1)
+	if len(eh.Probes()) != 1 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
 	}
 
-	if eh.probes[0] != dummyProbePath {
-		t.Fatalf("Invalid handler probe path %s, expected %s", eh.probes[0], dummyProbePath)
+	if eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler probe path %s, expected %s", eh.Probes()[0], dummyProbePath)
 	}
 
-	if _, ok := w.directories[path].probes[dummyProbePath]; !ok {
+	if _, ok := watchedProbe(w, path, dummyProbePath); !ok {
 		t.Fatalf("Missing probe %s from watcher", dummyProbePath)
 	}
 }
@@ -240,20 +347,20 @@ func TestAddProbe(t *testing.T) {
 	}
 	defer w.Shutdown()
 
-	if len(w.directories) != 1 {
-		t.Fatalf("Invalid watcher directory count : %d, expected %d", len(w.directories), 1)
+	if directoryCount(w) != 1 {
+		t.Fatalf("Invalid watcher directory count : %d, expected %d", directoryCount(w), 1)
 	}
 
-	if w.directories[path].path != path {
-		t.Fatalf("Invalid watcher directory path %s, expected %s", w.directories[path].path, path)
+	if watchedDirectory(w, path).path != path {
+		t.Fatalf("Invalid watcher directory path %s, expected %s", watchedDirectory(w, path).path, path)
 	}
 
-	if len(eh.directories) != 1 {
-		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.directories), 1)
+	if len(eh.Directories()) != 1 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 1)
 	}
 
-	if eh.directories[0] != path {
-		t.Fatalf("Invalid handler directory path %s, expected %s", eh.directories[0], path)
+	if eh.Directories()[0] != path {
+		t.Fatalf("Invalid handler directory path %s, expected %s", eh.Directories()[0], path)
 	}
 
 	// Create fake probe
@@ -267,15 +374,15 @@ func TestAddProbe(t *testing.T) {
 	// Wait for fsnotify event to be triggered and processed
 	time.Sleep(time.Duration(100) * time.Millisecond)
 
-	if len(eh.probes) != 1 {
-		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.probes), 1)
+	if len(eh.Probes()) != 1 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
 	}
 
-	if eh.probes[0] != dummyProbePath {
-		t.Fatalf("Invalid handler directory path %s, expected %s", eh.probes[0], dummyProbePath)
+	if eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler directory path %s, expected %s", eh.Probes()[0], dummyProbePath)
 	}
 
-	if _, ok := w.directories[path].probes[dummyProbePath]; !ok {
+	if _, ok := watchedProbe(w, path, dummyProbePath); !ok {
 		t.Fatalf("Missing probe %s from watcher", dummyProbePath)
 	}
 }
@@ -306,28 +413,28 @@ func TestRemoveProbe(t *testing.T) {
 	}
 	defer w.Shutdown()
 
-	if len(w.directories) != 1 {
-		t.Fatalf("Invalid watcher directory count : %d, expected %d", len(w.directories), 1)
+	if directoryCount(w) != 1 {
+		t.Fatalf("Invalid watcher directory count : %d, expected %d", directoryCount(w), 1)
 	}
 
-	if w.directories[path].path != path {
-		t.Fatalf("Invalid watcher directory path %s, expected %s", w.directories[path].path, path)
+	if watchedDirectory(w, path).path != path {
+		t.Fatalf("Invalid watcher directory path %s, expected %s", watchedDirectory(w, path).path, path)
 	}
 
-	if len(eh.directories) != 1 {
-		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.directories), 1)
+	if len(eh.Directories()) != 1 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 1)
 	}
 
-	if eh.directories[0] != path {
-		t.Fatalf("Invalid handler directory path %s, expected %s", eh.directories[0], path)
+	if eh.Directories()[0] != path {
+		t.Fatalf("Invalid handler directory path %s, expected %s", eh.Directories()[0], path)
 	}
 
-	if len(eh.probes) != 1 {
-		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.probes), 1)
+	if len(eh.Probes()) != 1 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
 	}
 
-	if eh.probes[0] != dummyProbePath {
-		t.Fatalf("Invalid handler directory path %s, expected %s", eh.probes[0], dummyProbePath)
+	if eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler directory path %s, expected %s", eh.Probes()[0], dummyProbePath)
 	}
 
 	// Remove dummy probe
@@ -339,8 +446,8 @@ func TestRemoveProbe(t *testing.T) {
 	// Wait for fsnotify event to be triggered and processed
 	time.Sleep(time.Duration(100) * time.Millisecond)
 
-	if len(eh.probes) != 0 {
-		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.probes), 0)
+	if len(eh.Probes()) != 0 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 0)
 	}
 }
 
@@ -370,28 +477,28 @@ func TestRemoveProbeDirectoryWithProbe(t *testing.T) {
 	}
 	defer w.Shutdown()
 
-	if len(w.directories) != 1 {
-		t.Fatalf("Invalid watcher directory count : %d, expected %d", len(w.directories), 1)
+	if directoryCount(w) != 1 {
+		t.Fatalf("Invalid watcher directory count : %d, expected %d", directoryCount(w), 1)
 	}
 
-	if w.directories[path].path != path {
-		t.Fatalf("Invalid watcher directory path %s, expected %s", w.directories[path].path, path)
+	if watchedDirectory(w, path).path != path {
+		t.Fatalf("Invalid watcher directory path %s, expected %s", watchedDirectory(w, path).path, path)
 	}
 
-	if len(eh.directories) != 1 {
-		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.directories), 1)
+	if len(eh.Directories()) != 1 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 1)
 	}
 
-	if eh.directories[0] != path {
-		t.Fatalf("Invalid handler directory path %s, expected %s", eh.directories[0], path)
+	if eh.Directories()[0] != path {
+		t.Fatalf("Invalid handler directory path %s, expected %s", eh.Directories()[0], path)
 	}
 
-	if len(eh.probes) != 1 {
-		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.probes), 1)
+	if len(eh.Probes()) != 1 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
 	}
 
-	if eh.probes[0] != dummyProbePath {
-		t.Fatalf("Invalid handler probe path %s, expected %s", eh.probes[0], dummyProbePath)
+	if eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler probe path %s, expected %s", eh.Probes()[0], dummyProbePath)
 	}
 
 	// Remove probe directory
@@ -403,16 +510,16 @@ func TestRemoveProbeDirectoryWithProbe(t *testing.T) {
 	// Wait for fsnotify event to be triggered and processed
 	time.Sleep(time.Duration(100) * time.Millisecond)
 
-	if len(w.directories) != 0 {
-		t.Fatalf("Invalid watcher directory count : %d, expected %d", len(w.directories), 0)
+	if directoryCount(w) != 0 {
+		t.Fatalf("Invalid watcher directory count : %d, expected %d", directoryCount(w), 0)
 	}
 
-	if len(eh.directories) != 0 {
-		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.probes), 0)
+	if len(eh.Directories()) != 0 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Probes()), 0)
 	}
 
-	if len(eh.probes) != 0 {
-		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.probes), 0)
+	if len(eh.Probes()) != 0 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 0)
 	}
 }
 
@@ -448,32 +555,32 @@ func TestMoveProbe(t *testing.T) {
 	}
 	defer w.Shutdown()
 
-	if len(w.directories) != 2 {
-		t.Fatalf("Invalid watcher directory count : %d, expected %d", len(w.directories), 1)
+	if directoryCount(w) != 2 {
+		t.Fatalf("Invalid watcher directory count : %d, expected %d", directoryCount(w), 1)
 	}
 
-	if w.directories[path].path != path {
-		t.Fatalf("Invalid directory path %s, expected %s", w.directories[path].path, path)
+	if watchedDirectory(w, path).path != path {
+		t.Fatalf("Invalid directory path %s, expected %s", watchedDirectory(w, path).path, path)
 	}
 
-	if _, ok := w.directories[path].probes[dummyProbePath]; !ok {
+	if _, ok := watchedProbe(w, path, dummyProbePath); !ok {
 		t.Fatalf("Missing probe %s from watcher", dummyProbePath)
 	}
 
-	if w.directories[path2].path != path2 {
-		t.Fatalf("Invalid directory path %s, expected %s", w.directories[path2].path, path2)
+	if watchedDirectory(w, path2).path != path2 {
+		t.Fatalf("Invalid directory path %s, expected %s", watchedDirectory(w, path2).path, path2)
 	}
 
-	if len(eh.directories) != 2 {
-		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.directories), 1)
+	if len(eh.Directories()) != 2 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 1)
 	}
 
-	if len(eh.probes) != 1 {
-		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.probes), 1)
+	if len(eh.Probes()) != 1 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
 	}
 
-	if eh.probes[0] != dummyProbePath {
-		t.Fatalf("Invalid handler probe path %s, expected %s", eh.probes[0], dummyProbePath)
+	if eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler probe path %s, expected %s", eh.Probes()[0], dummyProbePath)
 	}
 
 	// Move fake probe
@@ -488,15 +595,492 @@ func TestMoveProbe(t *testing.T) {
 	// Wait for fsnotify event to be triggered and processed
 	time.Sleep(time.Duration(100) * time.Millisecond)
 
-	if len(eh.probes) != 1 {
-		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.probes), 1)
+	if len(eh.Probes()) != 1 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
 	}
 
-	if eh.probes[0] != dummyProbePath2 {
-		t.Fatalf("Invalid handler probe path %s, expected %s", eh.probes[0], dummyProbePath)
+	if eh.Probes()[0] != dummyProbePath2 {
+		t.Fatalf("Invalid handler probe path %s, expected %s", eh.Probes()[0], dummyProbePath)
 	}
 
-	if _, ok := w.directories[path2].probes[dummyProbePath2]; !ok {
+	if _, ok := watchedProbe(w, path2, dummyProbePath2); !ok {
 		t.Fatalf("Missing probe %s from watcher", dummyProbePath2)
 	}
 }
+
+func TestRecursiveProbeDirectoryWatcher(t *testing.T) {
+	if err := setupWatcherTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	config.GetConfig().Watcher.Recursive = true
+	defer config.LoadDefaultConfig()
+
+	// Create team probe directory with a probe
+	path := tmpProbeDirectory + "/infra/60"
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", path, err)
+	}
+	dummyProbePath := path + "/dummy.pl"
+	file, err := os.Create(dummyProbePath)
+	if err != nil {
+		t.Fatalf("Unable to create fake probe  %s : %s", dummyProbePath, err)
+	}
+	file.Close()
+
+	eh := NewTestEventHandler()
+	w, err := NewProbeDirectoryWatcher(tmpProbeDirectory, eh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Shutdown()
+
+	if len(eh.Directories()) != 2 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 2)
+	}
+	if len(eh.Probes()) != 1 || eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Missing probe %s from handler", dummyProbePath)
+	}
+
+	// Create a new team probe directory
+	path2 := tmpProbeDirectory + "/infra/hourly"
+	if err := os.Mkdir(path2, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", path2, err)
+	}
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	dummyProbePath2 := path2 + "/dummy2.pl"
+	if file, err = os.Create(dummyProbePath2); err != nil {
+		t.Fatalf("Unable to create fake probe  %s : %s", dummyProbePath2, err)
+	}
+	file.Close()
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if len(eh.Directories()) != 3 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 3)
+	}
+	if len(eh.Probes()) != 2 || eh.Probes()[1] != dummyProbePath2 {
+		t.Fatalf("Missing probe %s from handler", dummyProbePath2)
+	}
+
+	// Remove the team directory
+	if err = os.RemoveAll(tmpProbeDirectory + "/infra"); err != nil {
+		t.Fatalf("Unable to remove probe directory : %s", err)
+	}
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if len(eh.Directories()) != 0 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 0)
+	}
+	if len(eh.Probes()) != 0 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 0)
+	}
+}
+
+func TestDebounceProbe(t *testing.T) {
+	if err := setupWatcherTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	config.GetConfig().Watcher.Debounce = 200
+
+	// Create probe directory
+	path := tmpProbeDirectory + "/1"
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", err, path)
+	}
+
+	eh := NewTestEventHandler()
+	w, err := NewProbeDirectoryWatcher(tmpProbeDirectory, eh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Shutdown()
+
+	// Write a probe slowly
+	dummyProbePath := path + "/dummy.pl"
+	file, err := os.Create(dummyProbePath)
+	if err != nil {
+		t.Fatalf("Unable to create fake probe  %s : %s", dummyProbePath, err)
+	}
+	for i := 0; i < 5; i++ {
+		file.WriteString("#!/usr/bin/perl\n")
+		time.Sleep(time.Duration(50) * time.Millisecond)
+	}
+	file.Close()
+
+	if len(eh.Probes()) != 0 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 0)
+	}
+
+	// Wait for fsnotify events to settle and be processed
+	time.Sleep(time.Duration(400) * time.Millisecond)
+
+	if len(eh.Probes()) != 1 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
+	}
+	if len(eh.Updates()) != 0 {
+		t.Fatalf("Invalid handler update count: %d, expected %d", len(eh.Updates()), 0)
+	}
+}
+
+func TestUpdateProbe(t *testing.T) {
+	if err := setupWatcherTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	// Create probe directory
+	path := tmpProbeDirectory + "/1"
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", err, path)
+	}
+
+	// Create fake probe
+	dummyProbePath := path + "/dummy.pl"
+	file, err := os.Create(dummyProbePath)
+	if err != nil {
+		t.Fatalf("Unable to create fake probe  %s : %s", dummyProbePath, err)
+	}
+	file.Close()
+
+	eh := NewTestEventHandler()
+	w, err := NewProbeDirectoryWatcher(tmpProbeDirectory, eh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Shutdown()
+
+	// Modify the probe in place
+	file, err = os.OpenFile(dummyProbePath, os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		t.Fatalf("Unable to open fake probe  %s : %s", dummyProbePath, err)
+	}
+	file.WriteString("#!/usr/bin/perl\n")
+	file.Close()
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if len(eh.Updates()) != 1 || eh.Updates()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler update count: %d, expected %d", len(eh.Updates()), 1)
+	}
+
+	// Deploy a new version of the probe atomically
+	tmpPath := path + "/.dummy.pl.tmp"
+	if file, err = os.Create(tmpPath); err != nil {
+		t.Fatalf("Unable to create fake probe  %s : %s", tmpPath, err)
+	}
+	file.Close()
+	if err = os.Rename(tmpPath, dummyProbePath); err != nil {
+		t.Fatalf("Unable to rename fake probe  %s : %s", tmpPath, err)
+	}
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if len(eh.Updates()) != 2 {
+		t.Fatalf("Invalid handler update count: %d, expected %d", len(eh.Updates()), 2)
+	}
+	if len(eh.Probes()) != 1 || eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
+	}
+}
+
+func TestPollingProbeDirectoryWatcher(t *testing.T) {
+	if err := setupWatcherTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	config.GetConfig().Watcher.Mode = config.WatcherPolling
+	config.GetConfig().Watcher.PollInterval = 1
+	defer config.LoadDefaultConfig()
+
+	// Create probe directory
+	path := tmpProbeDirectory + "/1"
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", err, path)
+	}
+
+	eh := NewTestEventHandler()
+	w, err := NewProbeDirectoryWatcher(tmpProbeDirectory, eh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Shutdown()
+
+	if !w.polling || !watchedDirectory(w, path).polling {
+		t.Fatal("Probe directories are not polled")
+	}
+	if len(eh.Fallbacks()) != 0 {
+		t.Fatalf("Invalid handler fallback count: %d, expected %d", len(eh.Fallbacks()), 0)
+	}
+
+	// Create fake probe and probe directory
+	dummyProbePath := path + "/dummy.pl"
+	file, err := os.Create(dummyProbePath)
+	if err != nil {
+		t.Fatalf("Unable to create fake probe  %s : %s", dummyProbePath, err)
+	}
+	file.Close()
+	path2 := tmpProbeDirectory + "/2"
+	if err := os.Mkdir(path2, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", err, path2)
+	}
+
+	// Wait for the directories to be scanned
+	time.Sleep(time.Duration(1500) * time.Millisecond)
+
+	if len(eh.Directories()) != 2 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 2)
+	}
+	if len(eh.Probes()) != 1 || eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
+	}
+
+	// Modify then remove fake probe
+	if err = os.Chmod(dummyProbePath, 0755); err != nil {
+		t.Fatalf("Unable to chmod fake probe %s : %s", dummyProbePath, err)
+	}
+	time.Sleep(time.Duration(1000) * time.Millisecond)
+	if len(eh.Updates()) != 1 {
+		t.Fatalf("Invalid handler update count: %d, expected %d", len(eh.Updates()), 1)
+	}
+	if err = os.RemoveAll(path); err != nil {
+		t.Fatalf("Unable to remove probe directory %s : %s", path, err)
+	}
+	time.Sleep(time.Duration(1000) * time.Millisecond)
+
+	if len(eh.Directories()) != 1 {
+		t.Fatalf("Invalid handler directory count: %d, expected %d", len(eh.Directories()), 1)
+	}
+	if len(eh.Probes()) != 0 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 0)
+	}
+}
+
+func TestIgnoreProbe(t *testing.T) {
+	if err := setupWatcherTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	// Create probe directory with a probe and a swap file
+	path := tmpProbeDirectory + "/1"
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatalf("Unable to create test probe directory %s : %s", err, path)
+	}
+	dummyProbePath := path + "/dummy.pl"
+	for _, probePath := range []string{dummyProbePath, path + "/.dummy.pl.swp"} {
+		file, err := os.Create(probePath)
+		if err != nil {
+			t.Fatalf("Unable to create fake probe  %s : %s", probePath, err)
+		}
+		file.Close()
+	}
+
+	eh := NewTestEventHandler()
+	w, err := NewProbeDirectoryWatcher(tmpProbeDirectory, eh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Shutdown()
+
+	if len(eh.Probes()) != 1 || eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
+	}
+
+	// Park the probe
+	if err = os.Rename(dummyProbePath, dummyProbePath+".disabled"); err != nil {
+		t.Fatalf("Unable to disable fake probe %s : %s", dummyProbePath, err)
+	}
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if len(eh.Probes()) != 0 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 0)
+	}
+
+	// Enable the probe again
+	if err = os.Rename(dummyProbePath+".disabled", dummyProbePath); err != nil {
+		t.Fatalf("Unable to enable fake probe %s : %s", dummyProbePath, err)
+	}
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if len(eh.Probes()) != 1 || eh.Probes()[0] != dummyProbePath {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 1)
+	}
+}
+
+func TestSymlinkProbe(t *testing.T) {
+	if err := setupWatcherTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+
+	// Create probe directory and a shared probe library
+	path := tmpProbeDirectory + "/1"
+	lib := tmpProbeLibDirectory
+	if err := os.RemoveAll(lib); err != nil {
+		t.Fatalf("Unable to remove test directory %s : %s", lib, err)
+	}
+	for _, dir := range []string{path, lib} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Unable to create test directory %s : %s", dir, err)
+		}
+	}
+	targetPath := lib + "/dummy.pl"
+	file, err := os.Create(targetPath)
+	if err != nil {
+		t.Fatalf("Unable to create fake probe  %s : %s", targetPath, err)
+	}
+	file.Close()
+
+	// Enable the probe twice and link a missing probe
+	dummyProbePath := path + "/dummy.pl"
+	for link, target := range map[string]string{
+		dummyProbePath:       targetPath,
+		path + "/dummy2.pl":  "../../wigo_probe_lib_test/dummy.pl",
+		path + "/missing.pl": lib + "/missing.pl",
+	} {
+		if err = os.Symlink(target, link); err != nil {
+			t.Fatalf("Unable to create probe symlink %s : %s", link, err)
+		}
+	}
+
+	eh := NewTestEventHandler()
+	w, err := NewProbeDirectoryWatcher(tmpProbeDirectory, eh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Shutdown()
+
+	// Only one of the links to the same probe is added
+	if len(eh.Probes()) != 2 {
+		t.Fatalf("Invalid handler probe count: %d, expected %d", len(eh.Probes()), 2)
+	}
+	if pf, ok := watchedProbe(w, path, path+"/missing.pl"); !ok || !pf.dangling() {
+		t.Fatal("Missing dangling probe from watcher")
+	}
+
+	// Modify the target of the probe
+	if file, err = os.OpenFile(targetPath, os.O_WRONLY|os.O_APPEND, 0755); err != nil {
+		t.Fatalf("Unable to open fake probe  %s : %s", targetPath, err)
+	}
+	file.WriteString("#!/usr/bin/perl\n")
+	file.Close()
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if len(eh.Updates()) != 1 {
+		t.Fatalf("Invalid handler update count: %d, expected %d", len(eh.Updates()), 1)
+	}
+
+	// Create the missing probe
+	if file, err = os.Create(lib + "/missing.pl"); err != nil {
+		t.Fatalf("Unable to create fake probe : %s", err)
+	}
+	file.Close()
+
+	// Wait for fsnotify event to be triggered and processed
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if pf, _ := watchedProbe(w, path, path+"/missing.pl"); pf.dangling() {
+		t.Fatal("Probe symlink is still dangling")
+	}
+	if len(eh.Updates()) != 2 || eh.Updates()[1] != path+"/missing.pl" {
+		t.Fatalf("Invalid handler update count: %d, expected %d", len(eh.Updates()), 2)
+	}
+}
+
+func TestProbeConfigWatcher(t *testing.T) {
+	if err := setupWatcherTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	if err := os.RemoveAll(tmpProbeConfigDirectory); err != nil {
+		t.Fatalf("Unable to remove test probe config directory %s : %s", tmpProbeConfigDirectory, err)
+	}
+	if err := os.Mkdir(tmpProbeConfigDirectory, 0755); err != nil {
+		t.Fatalf("Unable to create test probe config directory %s : %s", tmpProbeConfigDirectory, err)
+	}
+	configPath := tmpProbeConfigDirectory + "/dummy.conf"
+	if err := ioutil.WriteFile(configPath, []byte(`{"enabled":true}`), 0644); err != nil {
+		t.Fatalf("Unable to write probe config %s : %s", configPath, err)
+	}
+
+	eh := NewTestEventHandler()
+	w, err := NewProbeConfigWatcher(tmpProbeConfigDirectory, eh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Shutdown()
+
+	// Existing configs are not reported
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	if len(eh.Configs()) != 0 {
+		t.Fatalf("Invalid handler config count: %d, expected %d", len(eh.Configs()), 0)
+	}
+
+	// Modify the config and write a file that is not a probe config
+	if err := ioutil.WriteFile(configPath, []byte(`{"enabled":false}`), 0644); err != nil {
+		t.Fatalf("Unable to write probe config %s : %s", configPath, err)
+	}
+	if err := ioutil.WriteFile(tmpProbeConfigDirectory+"/README", []byte("readme"), 0644); err != nil {
+		t.Fatalf("Unable to write file : %s", err)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	if len(eh.Configs()) != 1 || eh.Configs()[0] != "dummy" {
+		t.Fatalf("Invalid handler configs : %v, expected %v", eh.Configs(), []string{"dummy"})
+	}
+
+	// Remove the config
+	if err := os.Remove(configPath); err != nil {
+		t.Fatalf("Unable to remove probe config %s : %s", configPath, err)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	if len(eh.Configs()) != 2 {
+		t.Fatalf("Invalid handler config count: %d, expected %d", len(eh.Configs()), 2)
+	}
+}
+
+func TestPollingProbeConfigWatcher(t *testing.T) {
+	if err := setupWatcherTest(); err != nil {
+		t.Fatalf("Unable to setup test : %s", err)
+	}
+	config.GetConfig().Watcher.Mode = config.WatcherPolling
+	config.GetConfig().Watcher.PollInterval = 1
+	config.GetConfig().Watcher.Debounce = 1500
+	defer config.LoadDefaultConfig()
+
+	if err := os.RemoveAll(tmpProbeConfigDirectory); err != nil {
+		t.Fatalf("Unable to remove test probe config directory %s : %s", tmpProbeConfigDirectory, err)
+	}
+	if err := os.Mkdir(tmpProbeConfigDirectory, 0755); err != nil {
+		t.Fatalf("Unable to create test probe config directory %s : %s", tmpProbeConfigDirectory, err)
+	}
+
+	eh := NewTestEventHandler()
+	w, err := NewProbeConfigWatcher(tmpProbeConfigDirectory, eh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Shutdown()
+
+	// A config being written is only reported once its changes have settled
+	configPath := tmpProbeConfigDirectory + "/dummy.conf"
+	if err := ioutil.WriteFile(configPath, []byte(`{"enabled":true}`), 0644); err != nil {
+		t.Fatalf("Unable to write probe config %s : %s", configPath, err)
+	}
+	time.Sleep(time.Duration(1200) * time.Millisecond)
+	if len(eh.Configs()) != 0 {
+		t.Fatalf("Invalid handler config count: %d, expected %d", len(eh.Configs()), 0)
+	}
+	time.Sleep(time.Duration(1000) * time.Millisecond)
+	if len(eh.Configs()) != 1 || eh.Configs()[0] != "dummy" {
+		t.Fatalf("Invalid handler configs : %v, expected %v", eh.Configs(), []string{"dummy"})
+	}
+}
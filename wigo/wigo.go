@@ -1,24 +1,49 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/root-gg/wigo/wigo/api"
 	"github.com/root-gg/wigo/wigo/config"
+	"github.com/root-gg/wigo/wigo/executor"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 	"github.com/root-gg/wigo/wigo/runner"
+	"github.com/root-gg/wigo/wigo/store"
 	"github.com/root-gg/wigo/wigo/global"
+	_ "github.com/root-gg/wigo/wigo/native/network"
+	_ "github.com/root-gg/wigo/wigo/native/ntp"
+	_ "github.com/root-gg/wigo/wigo/native/system"
 //	"github.com/root-gg/utils"
 )
 
 var wigo *global.Wigo
+var pr *runner.ProbeRunner
 
 func main() {
 	log.Info("Hello wigo")
 
 	// Parse command line arguments
 	var configFile = flag.String("config", "/etc/wigo/wigo.conf", "Configuration file (default: /etc/wigo/wigo.conf)")
+	var check = flag.Bool("check", false, "Check the configuration file and exit, non-zero if it has errors")
+	var overrides overrideFlags
+	flag.Var(&overrides, "set", "Override a configuration key ( eg : -set Http.Port=4001 ), can be repeated")
 	flag.Parse()
+	config.SetOverrides(overrides)
+
+	// Check config
+	if *check {
+		os.Exit(checkConfig(*configFile))
+	}
 
 	// Load config
 	if err := config.LoadConfig(*configFile); err != nil {
@@ -38,28 +63,272 @@ func main() {
 	// Create local wigo
 	wigo = global.NewWigo()
 	wigo.Hostname = config.GetConfig().Global.Hostname
+	uuid, err := global.LoadUuid(config.GetConfig().Global.UuidFile)
+	if err != nil {
+		log.Warnf("Unable to load uuid from %s : %s", config.GetConfig().Global.UuidFile, err)
+		os.Exit(1)
+	}
+	wigo.Uuid = uuid
+
+	// Set probes environment
+	env := new(executor.ProbeEnvironment)
+	env.ConfigRoot = config.GetConfig().Global.ProbesConfigDirectory
+	env.LibRoot = config.GetConfig().Global.ProbesLibDirectory
+	env.StateRoot = config.GetConfig().Global.ProbesStateDirectory
+	env.Hostname = wigo.Hostname
+	env.Group = config.GetConfig().Global.Group
+	env.Uuid = wigo.Uuid
+	executor.SetEnvironment(env)
+
+	// Open probes persistent data store
+	db, err := store.NewStore(config.GetConfig().Global.Database)
+	if err != nil {
+		log.Warnf("Unable to open database : %s", err)
+		os.Exit(1)
+	}
+	executor.SetStore(db)
 
 	// Start local probe runner
-	pr, err := runner.NewProbeRunner(config.GetConfig().Global.ProbesDirectory)
+	pr, err = runner.NewProbeRunner(config.GetConfig().Global.ProbesDirectory)
 	if err != nil {
-		log.Warn("Unable to start local probe runner : %s", err)
+		log.Warnf("Unable to start local probe runner : %s", err)
+		os.Exit(1)
+	}
+
+	// Accept passive probe results and api calls
+	if err := startServers(); err != nil {
+		log.Warnf("Unable to start servers : %s", err)
 		os.Exit(1)
 	}
 
+	// Reload the configuration on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Info("SIGHUP received, reloading configuration")
+			reloadConfig()
+		}
+	}()
+
 	// Handle local probe results
 	go func(){
+		expiry := time.NewTicker(10 * time.Second)
 		for {
-			result := <- pr.Results()
-			oldResult := wigo.UpdateProbe(result)
-			compareProbeResults(oldResult,result)
+			select {
+			case result := <- pr.Results():
+				oldResult := wigo.UpdateProbe(result)
+				compareProbeResults(oldResult,result)
+			case name := <- pr.Removed():
+				wigo.RemoveProbe(name)
+			case <- expiry.C:
+				for _, result := range wigo.ExpiredProbes() {
+					oldResult := wigo.UpdateProbe(result)
+					compareProbeResults(oldResult,result)
+				}
+			}
 		}
 	}()
 
 	select{}
 }
 
-func compareProbeResults(old *runner.ProbeResult, new *runner.ProbeResult){
-	if old.Status != new.Status {
+var (
+	servers     []*http.Server
+	serversLock sync.Mutex
+	reloadLock  sync.Mutex
+)
+
+// startServers accept passive probe results on the local unix
+// socket and api calls on the http server if enabled
+func startServers() (err error) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	c := config.GetConfig()
+	mux := http.NewServeMux()
+
+	if c.Passive.Enabled {
+		submit := func(name string, result *executor.ProbeResult, ttl int) error {
+			oldResult, err := wigo.SubmitPassiveProbe(name, result, ttl)
+			if err == nil {
+				compareProbeResults(oldResult, result)
+			}
+			return err
+		}
+		remove := func(name string) {
+			wigo.RemovePassiveProbe(name)
+		}
+
+		server, err := api.ServeUnixSocket(c.Passive.Socket, api.NewPassiveHandler(submit, remove, c.Passive.DefaultTtl))
+		if err != nil {
+			return err
+		}
+		servers = append(servers, server)
+
+		// Anyone reaching the http server could submit results
+		if c.Http.Login != "" {
+			handler := api.NewPassiveHandler(submit, remove, c.Passive.DefaultTtl)
+			handler.Login = c.Http.Login
+			handler.Password = c.Http.Password
+			mux.Handle("/passive/", handler)
+		} else if c.Http.Enabled {
+			log.Info("Passive results are only accepted on the local socket, set Http.Login to accept them on the http server")
+		}
+	}
+
+	if c.Http.Enabled {
+		// Anyone reaching the http server could reload the configuration
+		if c.Http.Login != "" {
+			handler := api.NewReloadHandler(reloadConfig)
+			handler.Login = c.Http.Login
+			handler.Password = c.Http.Password
+			mux.Handle("/reload", handler)
+		}
+
+		server := &http.Server{Addr: net.JoinHostPort(c.Http.Address, strconv.Itoa(c.Http.Port)), Handler: mux}
+		servers = append(servers, server)
+		go func() {
+			var err error
+			if c.Http.SslEnabled {
+				err = server.ListenAndServeTLS(c.Http.SslCert, c.Http.SslKey)
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				log.Warnf("Http server stopped : %s", err)
+			}
+		}()
+	}
+	return
+}
+
+// stopServers stop the servers started by startServers,
+// waiting for the requests being served to complete
+func stopServers() {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	for _, server := range servers {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := server.Shutdown(ctx); err != nil {
+			log.Warnf("Unable to stop server : %s", err)
+		}
+		cancel()
+	}
+	servers = nil
+}
+
+// reloadConfig parse the configuration file again and restart the
+// subsystems whose configuration changed. The local wigo state and the
+// executors of the probes are kept, an invalid configuration is not applied.
+func reloadConfig() (changed []string, err error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	old := config.GetConfig()
+	if changed, err = config.ReloadConfig(); err != nil {
+		log.Warnf("Unable to reload configuration, keeping the current one : %s", err)
+		return
+	}
+	c := config.GetConfig()
+	log.Infof("Configuration reloaded, changed sections : %v", changed)
+
+	reloadProbes, updateSettings, restartServers := false, false, false
+	for _, section := range changed {
+		switch section {
+		case "Global":
+			if c.Global.Debug {
+				log.SetLevel(log.DebugLevel)
+			} else {
+				log.SetLevel(log.InfoLevel)
+			}
+			if c.Global.Hostname != old.Global.Hostname || c.Global.Database != old.Global.Database || c.Global.UuidFile != old.Global.UuidFile {
+				log.Warn("Hostname, Database and UuidFile changes are only applied on restart")
+			}
+
+			env := new(executor.ProbeEnvironment)
+			*env = *executor.GetEnvironment()
+			env.ConfigRoot = c.Global.ProbesConfigDirectory
+			env.LibRoot = c.Global.ProbesLibDirectory
+			env.StateRoot = c.Global.ProbesStateDirectory
+			env.Group = c.Global.Group
+			executor.SetEnvironment(env)
+
+			if c.Global.ProbesDirectory != old.Global.ProbesDirectory || c.Global.ProbesConfigDirectory != old.Global.ProbesConfigDirectory {
+				reloadProbes = true
+			}
+		case "Watcher":
+			reloadProbes = true
+		case "Http", "Passive":
+			restartServers = true
+		case "Probes":
+			updateSettings = true
+		default:
+			if config.RestartRequired(section) {
+				log.Warnf("%s configuration changed, restart the agent to apply it", section)
+				continue
+			}
+			log.Infof("%s configuration updated", section)
+		}
+	}
+
+	if reloadProbes {
+		if err := pr.Reload(c.Global.ProbesDirectory); err != nil {
+			log.Warnf("Unable to reload probe directory %s : %s", c.Global.ProbesDirectory, err)
+		}
+	}
+	if updateSettings {
+		pr.UpdateSettings()
+	}
+
+	// The reload may be an api call served by the http server
+	// being restarted, let the call complete before restarting it
+	if restartServers {
+		go func() {
+			stopServers()
+			if err := startServers(); err != nil {
+				log.Warnf("Unable to restart servers : %s", err)
+			}
+		}()
+	}
+	return changed, nil
+}
+
+// overrideFlags holds the repeated -set key=value flags
+type overrideFlags []string
+
+func (o *overrideFlags) String() string {
+	return strings.Join(*o, " ")
+}
+
+func (o *overrideFlags) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
+// checkConfig print the problems found in the configuration
+// file and return the exit code of the check mode
+func checkConfig(configFile string) int {
+	_, problems := config.Check(configFile)
+	for _, p := range problems {
+		level := "ERROR"
+		if p.Warning {
+			level = "WARNING"
+		}
+		fmt.Printf("%-8s %s\n", level, p)
+	}
+
+	if errors := problems.Errors(); len(errors) > 0 {
+		fmt.Printf("%s : %d error(s), %d warning(s)\n", configFile, len(errors), len(problems)-len(errors))
+		return 1
+	}
+	fmt.Printf("%s : OK, %d warning(s)\n", configFile, len(problems))
+	return 0
+}
+
+func compareProbeResults(old *executor.ProbeResult, new *executor.ProbeResult){
+	if old != nil && old.Status != new.Status {
 //		notify.Handle(old,new)
 //		log.Handle(old,new)
 	}
@@ -69,6 +338,6 @@ func compareWigo(old *global.Wigo, new *global.Wigo){
 
 }
 
-func saveMetrics(pr *runner.ProbeResult){
+func saveMetrics(pr *executor.ProbeResult){
 
 }
\ No newline at end of file